@@ -0,0 +1,251 @@
+package control
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ecwid/control/protocol/runtime"
+)
+
+// argumentMarker is the key of objects describing values which JSON can't hold, they are revived in the page
+const argumentMarker = `$control`
+
+// reviveArgumentsFunc wraps the function to revive its arguments, %d is a number of the arguments followed by the handles,
+// %s are JSON array of indexes of the encoded arguments, callbackStub and the function itself.
+// Arguments passed by object id or as unserializable value are not revived, nodes can't be walked as plain objects
+const reviveArgumentsFunc = `function(...a){const h=a.splice(%d),j=%s,b=(%s),r=v=>{if(v===null||typeof v!=='object')return v;if(Array.isArray(v))return v.map(r);switch(v['` + argumentMarker + `']){case 'handle':return h[v.v];case 'number':return Number(v.v);case 'bigint':return BigInt(v.v);case 'date':return new Date(v.v);case 'bytes':return Uint8Array.from(atob(v.v),c=>c.charCodeAt(0));case 'func':return b(v.v)}const o={};for(const k in v)o[k]=r(v[k]);return o};return (%s).apply(this,a.map((v,i)=>j.includes(i)?r(v):v))}`
+
+var bigIntType = reflect.TypeOf(big.Int{})
+
+// argumentEncoder converts Go values to JSON values, nodes and remote objects are passed by handle,
+// special numbers, dates, buffers and functions are replaced with markers revived by reviveArgumentsFunc
+type argumentEncoder struct {
+	frame     Frame
+	handles   []runtime.RemoteObjectId
+	callbacks []string
+	revive    bool
+}
+
+func marker(kind string, value any) map[string]any {
+	return map[string]any{argumentMarker: kind, "v": value}
+}
+
+// callArguments returns the function declaration and its arguments per CDP rules,
+// the function is wrapped if any argument must be revived in the page.
+// Release unregisters Go functions of the arguments, they are callable until the call returns
+func (f Frame) callArguments(function string, args ...any) (declaration string, arguments []*runtime.CallArgument, release func(), err error) {
+	var (
+		encoder = &argumentEncoder{frame: f}
+		encoded = []int{}
+	)
+	release = func() { f.session.unregisterCallbacks(encoder.callbacks...) }
+	arguments = make([]*runtime.CallArgument, len(args))
+	for n, arg := range args {
+		if argument, ok := unserializableArgument(arg); ok {
+			arguments[n] = argument
+			continue
+		}
+		value, err := encoder.encode(reflect.ValueOf(arg))
+		if err != nil {
+			release()
+			return "", nil, nil, fmt.Errorf("argument %d: %w", n, err)
+		}
+		arguments[n] = &runtime.CallArgument{Value: value}
+		encoded = append(encoded, n)
+	}
+	if !encoder.revive {
+		return function, arguments, release, nil
+	}
+	for _, id := range encoder.handles {
+		arguments = append(arguments, &runtime.CallArgument{ObjectId: id})
+	}
+	indexes, _ := json.Marshal(encoded)
+	return fmt.Sprintf(reviveArgumentsFunc, len(args), indexes, callbackStub, function), arguments, release, nil
+}
+
+// unserializableArgument passes remote objects by id and special numbers as unserializableValue without revive
+func unserializableArgument(arg any) (*runtime.CallArgument, bool) {
+	switch typed := arg.(type) {
+	case RemoteObject:
+		if v := reflect.ValueOf(typed); v.Kind() == reflect.Pointer && v.IsNil() {
+			return nil, false
+		}
+		return &runtime.CallArgument{ObjectId: typed.GetRemoteObjectID()}, true
+	case *big.Int:
+		if typed != nil {
+			return &runtime.CallArgument{UnserializableValue: runtime.UnserializableValue(typed.String() + "n")}, true
+		}
+	case float64:
+		if s, ok := unserializableNumber(typed); ok {
+			return &runtime.CallArgument{UnserializableValue: runtime.UnserializableValue(s)}, true
+		}
+	case float32:
+		if s, ok := unserializableNumber(float64(typed)); ok {
+			return &runtime.CallArgument{UnserializableValue: runtime.UnserializableValue(s)}, true
+		}
+	}
+	return nil, false
+}
+
+func unserializableNumber(f float64) (string, bool) {
+	switch {
+	case math.IsNaN(f):
+		return "NaN", true
+	case math.IsInf(f, 1):
+		return "Infinity", true
+	case math.IsInf(f, -1):
+		return "-Infinity", true
+	case f == 0 && math.Signbit(f):
+		return "-0", true
+	}
+	return "", false
+}
+
+func (e *argumentEncoder) encode(v reflect.Value) (any, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func:
+		if v.IsNil() {
+			return nil, nil
+		}
+	}
+	if v.CanInterface() {
+		switch typed := v.Interface().(type) {
+		case RemoteObject:
+			e.revive = true
+			e.handles = append(e.handles, typed.GetRemoteObjectID())
+			return marker("handle", len(e.handles)-1), nil
+		case *big.Int:
+			e.revive = true
+			return marker("bigint", typed.String()), nil
+		case time.Time:
+			e.revive = true
+			return marker("date", typed.Format(time.RFC3339Nano)), nil
+		case []byte:
+			e.revive = true
+			return marker("bytes", base64.StdEncoding.EncodeToString(typed)), nil
+		case json.Marshaler:
+			return marshalToValue(typed)
+		}
+	}
+	if v.Type() == bigIntType {
+		n := v.Interface().(big.Int)
+		return e.encode(reflect.ValueOf(&n))
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		if s, ok := unserializableNumber(v.Float()); ok {
+			e.revive = true
+			return marker("number", s), nil
+		}
+		return v.Float(), nil
+	case reflect.Pointer, reflect.Interface:
+		return e.encode(v.Elem())
+	case reflect.Func:
+		fn, err := toBindingFunc(v.Interface())
+		if err != nil {
+			return nil, err
+		}
+		name, err := e.frame.session.registerCallback("", fn)
+		if err != nil {
+			return nil, err
+		}
+		e.callbacks = append(e.callbacks, name)
+		e.revive = true
+		return marker("func", name), nil
+	case reflect.Slice, reflect.Array:
+		arr := make([]any, v.Len())
+		for n := range arr {
+			value, err := e.encode(v.Index(n))
+			if err != nil {
+				return nil, err
+			}
+			arr[n] = value
+		}
+		return arr, nil
+	case reflect.Map:
+		obj := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value, err := e.encode(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			obj[fmt.Sprint(iter.Key().Interface())] = value
+		}
+		return obj, nil
+	case reflect.Struct:
+		obj := map[string]any{}
+		if err := e.encodeStruct(v, obj); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	default:
+		return nil, fmt.Errorf("%s can't be passed to the page", v.Type())
+	}
+}
+
+// encodeStruct follows encoding/json rules for field names, `-` and omitempty options, embedded structs are inlined
+func (e *argumentEncoder) encodeStruct(v reflect.Value, obj map[string]any) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			if !field.IsExported() {
+				continue // fields of unexported embedded struct are read-only
+			}
+			if err := e.encodeStruct(v.Field(i), obj); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if strings.Contains(options, "omitempty") && v.Field(i).IsZero() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		value, err := e.encode(v.Field(i))
+		if err != nil {
+			return err
+		}
+		obj[name] = value
+	}
+	return nil
+}
+
+func marshalToValue(value json.Marshaler) (any, error) {
+	b, err := value.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var result any
+	if err = json.Unmarshal(b, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
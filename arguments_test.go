@@ -0,0 +1,53 @@
+package control
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCallArgumentsNodeWithRevivedArgument(t *testing.T) {
+	var (
+		session = &Session{callbacks: &callbackRegistry{funcs: map[string]bindingFunc{}}}
+		frame   = Frame{session: session}
+		node    = &Node{object: remoteObjectValue("node-1"), frame: &frame}
+		date    = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+	declaration, arguments, release, err := frame.callArguments(`function(n, d){}`, node, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if len(arguments) != 2 {
+		t.Fatalf("%d arguments, expected 2", len(arguments))
+	}
+	if arguments[0].ObjectId != "node-1" || arguments[0].Value != nil {
+		t.Errorf("node is not passed by object id: %+v", arguments[0])
+	}
+	value, ok := arguments[1].Value.(map[string]any)
+	if !ok || value[argumentMarker] != "date" {
+		t.Errorf("date is not encoded with marker: %+v", arguments[1].Value)
+	}
+	if !strings.Contains(declaration, `j=[1]`) {
+		t.Errorf("only the encoded argument must be revived: %s", declaration)
+	}
+}
+
+func TestCallArgumentsWithoutRevive(t *testing.T) {
+	var (
+		session = &Session{callbacks: &callbackRegistry{funcs: map[string]bindingFunc{}}}
+		frame   = Frame{session: session}
+		node    = &Node{object: remoteObjectValue("node-1"), frame: &frame}
+	)
+	declaration, arguments, release, err := frame.callArguments(`function(n, s){}`, node, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if declaration != `function(n, s){}` {
+		t.Errorf("function is wrapped without revived arguments: %s", declaration)
+	}
+	if arguments[0].ObjectId != "node-1" || arguments[1].Value != "text" {
+		t.Errorf("unexpected arguments: %+v, %+v", arguments[0], arguments[1])
+	}
+}
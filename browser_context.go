@@ -0,0 +1,155 @@
+package control
+
+import (
+	"errors"
+
+	"github.com/ecwid/control/cdp"
+	"github.com/ecwid/control/protocol/browser"
+	"github.com/ecwid/control/protocol/common"
+	"github.com/ecwid/control/protocol/network"
+	"github.com/ecwid/control/protocol/storage"
+	"github.com/ecwid/control/protocol/target"
+)
+
+type BrowserContextOptions struct {
+	// ProxyServer overrides the browser's proxy for this context, e.g. `http://127.0.0.1:8080`
+	ProxyServer     string
+	ProxyBypassList string
+	// DownloadPath allows downloads to the directory
+	DownloadPath string
+}
+
+// BrowserContext is an incognito-like profile, pages of different contexts don't share cookies and storage
+type BrowserContext struct {
+	transport *cdp.Transport
+	id        common.BrowserContextID
+}
+
+func NewBrowserContext(transport *cdp.Transport, options BrowserContextOptions) (*BrowserContext, error) {
+	value, err := target.CreateBrowserContext(transport, target.CreateBrowserContextArgs{
+		DisposeOnDetach: true,
+		ProxyServer:     options.ProxyServer,
+		ProxyBypassList: options.ProxyBypassList,
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := &BrowserContext{
+		transport: transport,
+		id:        value.BrowserContextId,
+	}
+	if options.DownloadPath != "" {
+		if err = c.SetDownloadBehavior("allow", options.DownloadPath, true); err != nil {
+			return nil, errors.Join(err, c.Close())
+		}
+	}
+	return c, nil
+}
+
+func (s *Session) NewBrowserContext(options BrowserContextOptions) (*BrowserContext, error) {
+	return NewBrowserContext(s.transport, options)
+}
+
+func (s *Session) MustNewBrowserContext(options BrowserContextOptions) *BrowserContext {
+	value, err := s.NewBrowserContext(options)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+func (c *BrowserContext) Call(method string, send, recv any) error {
+	return c.transport.Call(method, send, recv)
+}
+
+func (c *BrowserContext) GetID() common.BrowserContextID {
+	return c.id
+}
+
+// NewPage opens a blank page in the context and attaches to it
+func (c *BrowserContext) NewPage() (*Session, error) {
+	tab, err := target.CreateTarget(c, target.CreateTargetArgs{
+		Url:              Blank,
+		BrowserContextId: c.id,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewSession(c.transport, tab.TargetId)
+}
+
+func (c *BrowserContext) MustNewPage() *Session {
+	value, err := c.NewPage()
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// Close closes all the pages of the context and removes its data
+func (c *BrowserContext) Close() error {
+	forgetDownloadBehavior(downloadScope{transport: c.transport, browserContextID: c.id})
+	return target.DisposeBrowserContext(c, target.DisposeBrowserContextArgs{BrowserContextId: c.id})
+}
+
+func (c *BrowserContext) GetCookies() Optional[[]*network.Cookie] {
+	value, err := storage.GetCookies(c, storage.GetCookiesArgs{BrowserContextId: c.id})
+	if err != nil {
+		return Optional[[]*network.Cookie]{err: err}
+	}
+	return Optional[[]*network.Cookie]{value: value.Cookies}
+}
+
+func (c *BrowserContext) MustGetCookies() []*network.Cookie {
+	return c.GetCookies().MustGetValue()
+}
+
+func (c *BrowserContext) SetCookies(cookies ...*network.CookieParam) error {
+	return storage.SetCookies(c, storage.SetCookiesArgs{Cookies: cookies, BrowserContextId: c.id})
+}
+
+func (c *BrowserContext) MustSetCookies(cookies ...*network.CookieParam) {
+	panicIfError(c.SetCookies(cookies...))
+}
+
+func (c *BrowserContext) ClearCookies() error {
+	return storage.ClearCookies(c, storage.ClearCookiesArgs{BrowserContextId: c.id})
+}
+
+func (c *BrowserContext) MustClearCookies() {
+	panicIfError(c.ClearCookies())
+}
+
+// GrantPermissions grants permissions to the origin, or to all origins if it's empty
+func (c *BrowserContext) GrantPermissions(origin string, permissions ...browser.PermissionType) error {
+	return browser.GrantPermissions(c, browser.GrantPermissionsArgs{
+		Permissions:      permissions,
+		Origin:           origin,
+		BrowserContextId: c.id,
+	})
+}
+
+func (c *BrowserContext) MustGrantPermissions(origin string, permissions ...browser.PermissionType) {
+	panicIfError(c.GrantPermissions(origin, permissions...))
+}
+
+func (c *BrowserContext) ResetPermissions() error {
+	return browser.ResetPermissions(c, browser.ResetPermissionsArgs{BrowserContextId: c.id})
+}
+
+func (c *BrowserContext) MustResetPermissions() {
+	panicIfError(c.ResetPermissions())
+}
+
+func (c *BrowserContext) SetDownloadBehavior(behavior string, downloadPath string, eventsEnabled bool) error {
+	return setDownloadBehavior(c, downloadScope{transport: c.transport, browserContextID: c.id}, browser.SetDownloadBehaviorArgs{
+		Behavior:         behavior,
+		BrowserContextId: c.id,
+		DownloadPath:     downloadPath,
+		EventsEnabled:    eventsEnabled,
+	})
+}
+
+func (c *BrowserContext) MustSetDownloadBehavior(behavior string, downloadPath string, eventsEnabled bool) {
+	panicIfError(c.SetDownloadBehavior(behavior, downloadPath, eventsEnabled))
+}
@@ -0,0 +1,253 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/ecwid/control/cdp"
+	"github.com/ecwid/control/protocol/page"
+	"github.com/ecwid/control/protocol/runtime"
+)
+
+const callbackBinding = `__control_callback`
+
+// callbackStub returns JS function calling Go function by name, the call is resolved with its result
+const callbackStub = `function(n){return (...x)=>new Promise((s,j)=>{const c=globalThis.__control_callbacks||(globalThis.__control_callbacks={seq:0,pending:new Map()}),q=++c.seq;c.pending.set(q,{s,j});globalThis.` + callbackBinding + `(JSON.stringify({name:n,seq:q,args:x}))})}`
+
+// settleCallback resolves or rejects the pending call of callbackStub
+const settleCallback = `((q,e,v)=>{const c=globalThis.__control_callbacks,p=c&&c.pending.get(q);if(!p)return;c.pending.delete(q);e===null?p.s(v):p.j(new Error(e))})`
+
+type bindingFunc func(args json.RawMessage) (any, error)
+
+type callbackPayload struct {
+	Name string          `json:"name"`
+	Seq  int             `json:"seq"`
+	Args json.RawMessage `json:"args"`
+}
+
+// callbackRegistry keeps Go functions callable from the page through the single binding
+type callbackRegistry struct {
+	mutex   sync.Mutex
+	funcs   map[string]bindingFunc
+	exposed []string
+	seq     int
+	cancel  func()
+}
+
+// registerCallback makes the function callable by name, the anonymous one is given a generated name
+func (s *Session) registerCallback(name string, fn bindingFunc) (string, error) {
+	r := s.callbacks
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.cancel == nil {
+		channel, cancel := s.Subscribe()
+		go s.handleCallbacks(channel)
+		if err := runtime.AddBinding(s, runtime.AddBindingArgs{Name: callbackBinding}); err != nil {
+			cancel()
+			return "", err
+		}
+		r.cancel = cancel
+	}
+	if name == "" {
+		r.seq++
+		name = fmt.Sprintf("callback%d", r.seq)
+	}
+	r.funcs[name] = fn
+	return name, nil
+}
+
+// unregisterCallbacks removes anonymous callbacks of the finished call
+func (s *Session) unregisterCallbacks(names ...string) {
+	if len(names) == 0 {
+		return
+	}
+	s.callbacks.mutex.Lock()
+	defer s.callbacks.mutex.Unlock()
+	for _, name := range names {
+		delete(s.callbacks.funcs, name)
+	}
+}
+
+// Expose installs window[name] in every frame of the page including out-of-process iframes and future documents.
+// The JS function returns a promise resolved with JSON of the fn result or rejected with its error,
+// args are JSON array of the call arguments. Calls are handled concurrently
+func (s *Session) Expose(name string, fn func(args json.RawMessage) (any, error)) error {
+	exposed, err := s.expose(name, fn)
+	if err != nil {
+		return err
+	}
+	if !exposed {
+		return fmt.Errorf("function `%s` is already exposed", name)
+	}
+	// children attached after the name is reserved get it from exposeTo, exposing twice is a no-op
+	for _, child := range s.Children() {
+		if _, err = child.expose(name, fn); err != nil && !child.IsDone() {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Session) MustExpose(name string, fn func(args json.RawMessage) (any, error)) {
+	panicIfError(s.Expose(name, fn))
+}
+
+// expose installs the function into the session once, exposed is false if the name is taken already
+func (s *Session) expose(name string, fn bindingFunc) (exposed bool, err error) {
+	r := s.callbacks
+	r.mutex.Lock()
+	if _, ok := r.funcs[name]; ok || slices.Contains(r.exposed, name) {
+		r.mutex.Unlock()
+		return false, nil
+	}
+	r.exposed = append(r.exposed, name)
+	r.mutex.Unlock()
+	if _, err = s.registerCallback(name, fn); err != nil {
+		r.mutex.Lock()
+		r.exposed = slices.DeleteFunc(r.exposed, func(value string) bool { return value == name })
+		r.mutex.Unlock()
+		return false, err
+	}
+
+	quoted, _ := json.Marshal(name)
+	script := fmt.Sprintf(`globalThis[%s]=(%s)(%s)`, quoted, callbackStub, quoted)
+	_, err = page.AddScriptToEvaluateOnNewDocument(s, page.AddScriptToEvaluateOnNewDocumentArgs{Source: script})
+	if err != nil {
+		return true, err
+	}
+	for _, frame := range s.Frames() {
+		if frame.session != s {
+			continue
+		}
+		if _, err = frame.evaluate(script, false); err != nil && err != ErrExecutionContextDestroyed {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// exposeTo installs functions exposed on the session into the auto-attached child session,
+// the set is taken under the lock so functions exposed concurrently are installed by Expose
+func (s *Session) exposeTo(child *Session) error {
+	s.callbacks.mutex.Lock()
+	var funcs = make(map[string]bindingFunc, len(s.callbacks.exposed))
+	for _, name := range s.callbacks.exposed {
+		if fn, ok := s.callbacks.funcs[name]; ok {
+			funcs[name] = fn
+		}
+	}
+	s.callbacks.mutex.Unlock()
+	for name, fn := range funcs {
+		if _, err := child.expose(name, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Session) callback(name string) (bindingFunc, bool) {
+	s.callbacks.mutex.Lock()
+	defer s.callbacks.mutex.Unlock()
+	fn, ok := s.callbacks.funcs[name]
+	return fn, ok
+}
+
+func (s *Session) handleCallbacks(channel chan cdp.Message) {
+	for message := range channel {
+		if message.Method != "Runtime.bindingCalled" {
+			continue
+		}
+		var called runtime.BindingCalled
+		if err := json.Unmarshal(message.Params, &called); err != nil || called.Name != callbackBinding {
+			continue
+		}
+		// callbacks may call back into the page, so they don't block each other
+		go s.invokeCallback(called)
+	}
+}
+
+func (s *Session) invokeCallback(called runtime.BindingCalled) {
+	var payload callbackPayload
+	if err := json.Unmarshal([]byte(called.Payload), &payload); err != nil {
+		s.Log("can't unmarshal callback payload", err)
+		return
+	}
+	var (
+		result any
+		err    error
+	)
+	if fn, ok := s.callback(payload.Name); ok {
+		result, err = fn(payload.Args)
+	} else {
+		err = fmt.Errorf("function `%s` is not exposed", payload.Name)
+	}
+	var value = []byte("null")
+	if err == nil {
+		value, err = json.Marshal(result)
+	}
+	var reason = []byte("null")
+	if err != nil {
+		reason, _ = json.Marshal(err.Error())
+	}
+	_, err = runtime.Evaluate(s, runtime.EvaluateArgs{
+		Expression: fmt.Sprintf("%s(%d,%s,%s)", settleCallback, payload.Seq, reason, value),
+		ContextId:  called.ExecutionContextId,
+	})
+	if err != nil {
+		s.Log("can't settle callback", err, "name", payload.Name)
+	}
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// toBindingFunc adapts Go function to bindingFunc, arguments of the JS call are unmarshalled into its parameters,
+// the function returns nothing, a value, an error or a value and an error
+func toBindingFunc(fn any) (bindingFunc, error) {
+	switch typed := fn.(type) {
+	case bindingFunc:
+		return typed, nil
+	case func(json.RawMessage) (any, error):
+		return typed, nil
+	}
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func || value.IsNil() || value.Type().IsVariadic() {
+		return nil, fmt.Errorf("%T can't be exposed as callback", fn)
+	}
+	t := value.Type()
+	switch {
+	case t.NumOut() > 2,
+		t.NumOut() == 2 && t.Out(1) != errorType:
+		return nil, fmt.Errorf("%s can't be exposed as callback, it returns more than a value and an error", t)
+	}
+	return func(args json.RawMessage) (any, error) {
+		var raw []json.RawMessage
+		if err := json.Unmarshal(args, &raw); err != nil {
+			return nil, err
+		}
+		in := make([]reflect.Value, t.NumIn())
+		for n := range in {
+			arg := reflect.New(t.In(n))
+			if n < len(raw) {
+				if err := json.Unmarshal(raw[n], arg.Interface()); err != nil {
+					return nil, fmt.Errorf("argument %d: %w", n, err)
+				}
+			}
+			in[n] = arg.Elem()
+		}
+		out := value.Call(in)
+		var result any
+		for _, v := range out {
+			if v.Type() == errorType {
+				if !v.IsNil() {
+					return nil, v.Interface().(error)
+				}
+				continue
+			}
+			result = v.Interface()
+		}
+		return result, nil
+	}, nil
+}
@@ -0,0 +1,46 @@
+package cdp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Pipe is a connection to the browser started with --remote-debugging-pipe,
+// messages are JSON encoded and delimited by NUL byte
+type Pipe struct {
+	reader *bufio.Reader
+	closer io.Closer
+	writer io.WriteCloser
+}
+
+// NewPipe creates connection over the browser's output (fd 4) and input (fd 3) pipes
+func NewPipe(reader io.ReadCloser, writer io.WriteCloser) *Pipe {
+	return &Pipe{
+		reader: bufio.NewReaderSize(reader, 8192),
+		closer: reader,
+		writer: writer,
+	}
+}
+
+func (p *Pipe) ReadJSON(v any) error {
+	message, err := p.reader.ReadBytes(0)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(message[:len(message)-1], v)
+}
+
+func (p *Pipe) WriteJSON(v any) error {
+	message, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = p.writer.Write(append(message, 0))
+	return err
+}
+
+func (p *Pipe) Close() error {
+	return errors.Join(p.writer.Close(), p.closer.Close())
+}
@@ -2,6 +2,7 @@ package cdp
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"log/slog"
 	"net/http"
@@ -20,15 +21,26 @@ var DefaultDialer = websocket.Dialer{
 
 var ErrGracefullyClosed = errors.New("gracefully closed")
 
+// DefaultTimeout is the time browser-level calls wait for the response
+var DefaultTimeout = 60 * time.Second
+
+// Conn is a connection to the browser exchanging JSON messages
+type Conn interface {
+	ReadJSON(v any) error
+	WriteJSON(v any) error
+	Close() error
+}
+
 type Transport struct {
 	context context.Context
 	cancel  func(error)
-	conn    *websocket.Conn
+	conn    Conn
 	seq     uint64
 	pending map[uint64]*promise[Response]
 	mutex   sync.Mutex
 	broker  broker
 	logger  *slog.Logger
+	timeout time.Duration
 }
 
 func DefaultDial(context context.Context, url string, logger *slog.Logger) (*Transport, error) {
@@ -40,6 +52,11 @@ func Dial(parent context.Context, dialer websocket.Dialer, url string, logger *s
 	if err != nil {
 		return nil, err
 	}
+	return New(parent, conn, logger), nil
+}
+
+// New starts the transport over already established connection (websocket or pipe)
+func New(parent context.Context, conn Conn, logger *slog.Logger) *Transport {
 	ctx, cancel := context.WithCancelCause(parent)
 	transport := &Transport{
 		context: ctx,
@@ -49,6 +66,7 @@ func Dial(parent context.Context, dialer websocket.Dialer, url string, logger *s
 		broker:  makeBroker(),
 		pending: make(map[uint64]*promise[Response]),
 		logger:  logger,
+		timeout: DefaultTimeout,
 	}
 	go transport.broker.run()
 	go func() {
@@ -58,7 +76,7 @@ func Dial(parent context.Context, dialer websocket.Dialer, url string, logger *s
 		transport.cancel(readerr)
 		transport.gracefullyClose()
 	}()
-	return transport, nil
+	return transport
 }
 
 func (t *Transport) Log(level slog.Level, msg string, args ...any) {
@@ -72,11 +90,16 @@ func (t *Transport) Context() context.Context {
 }
 
 func (t *Transport) Close() error {
+	return t.CloseWithContext(t.context)
+}
+
+// CloseWithContext sends Browser.close and waits for the response until ctx is done
+func (t *Transport) CloseWithContext(ctx context.Context) error {
 	select {
 	case <-t.context.Done():
 		return context.Cause(t.context)
 	default:
-		_, err := t.Send(&Request{Method: "Browser.close"}).Get(t.context)
+		_, err := t.Send(&Request{Method: "Browser.close"}).Get(ctx)
 		if err != nil {
 			return err
 		}
@@ -85,6 +108,38 @@ func (t *Transport) Close() error {
 	}
 }
 
+// Disconnect closes the connection and leaves the browser running
+func (t *Transport) Disconnect() error {
+	select {
+	case <-t.context.Done():
+		return context.Cause(t.context)
+	default:
+		t.cancel(ErrGracefullyClosed)
+		return t.conn.Close()
+	}
+}
+
+// SetTimeout sets the time browser-level calls wait for the response
+func (t *Transport) SetTimeout(timeout time.Duration) {
+	t.timeout = timeout
+}
+
+// Call sends the browser-level (without session) request and waits for the response
+func (t *Transport) Call(method string, send, recv any) error {
+	future := t.Send(&Request{Method: method, Params: send})
+	defer future.Cancel()
+	ctx, cancel := context.WithTimeout(t.context, t.timeout)
+	defer cancel()
+	value, err := future.Get(ctx)
+	if err != nil {
+		return err
+	}
+	if recv != nil {
+		return json.Unmarshal(value.Result, recv)
+	}
+	return nil
+}
+
 func (t *Transport) gracefullyClose() {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,12 +15,26 @@ import (
 	"time"
 )
 
-var MaxTimeToStart = 10 * time.Second
+// PipeFlag starts the browser with DevTools protocol over pipes (fd 3 and 4) instead of websocket
+const PipeFlag = "--remote-debugging-pipe"
 
 type Chrome struct {
 	WebSocketUrl string
 	StartArgs    string
 	cmd          *exec.Cmd
+	pipeReader   io.ReadCloser
+	pipeWriter   io.WriteCloser
+	process      *process
+}
+
+// IsPipe reports whether the browser is started with PipeFlag
+func (c Chrome) IsPipe() bool {
+	return c.pipeReader != nil
+}
+
+// Pipe returns the browser's output and input pipes
+func (c Chrome) Pipe() (reader io.ReadCloser, writer io.WriteCloser) {
+	return c.pipeReader, c.pipeWriter
 }
 
 type Target struct {
@@ -32,6 +47,35 @@ type Target struct {
 	WebSocketDebuggerUrl string `json:"webSocketDebuggerUrl,omitempty"`
 }
 
+type Version struct {
+	Browser              string `json:"Browser,omitempty"`
+	ProtocolVersion      string `json:"Protocol-Version,omitempty"`
+	UserAgent            string `json:"User-Agent,omitempty"`
+	V8Version            string `json:"V8-Version,omitempty"`
+	WebKitVersion        string `json:"WebKit-Version,omitempty"`
+	WebSocketDebuggerUrl string `json:"webSocketDebuggerUrl,omitempty"`
+}
+
+// GetVersion requests /json/version of the browser listening on the address (http://host:port)
+func GetVersion(ctx context.Context, cli *http.Client, address string) (version Version, err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(address, "/")+"/json/version", nil)
+	if err != nil {
+		return version, err
+	}
+	r, err := cli.Do(request)
+	if err != nil {
+		return version, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return version, fmt.Errorf("unexpected status of /json/version: %s", r.Status)
+	}
+	if err = json.NewDecoder(r.Body).Decode(&version); err != nil {
+		return version, err
+	}
+	return version, nil
+}
+
 func (c Chrome) NewTab(cli *http.Client, address string) (target Target, err error) {
 	u, err := url.Parse(c.WebSocketUrl)
 	if err != nil {
@@ -59,11 +103,15 @@ func (c Chrome) NewTab(cli *http.Client, address string) (target Target, err err
 	return
 }
 
-func (c Chrome) Wait() error {
-	return c.cmd.Wait()
-}
+var ErrBinaryNotFound = errors.New("chrome binary not found")
 
-func bin() string {
+func bin(binary string) (string, error) {
+	if binary == "" {
+		binary = os.Getenv("CHROME_PATH")
+	}
+	if binary != "" {
+		return exec.LookPath(binary)
+	}
 	for _, path := range []string{
 		"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
 		"/usr/bin/google-chrome",
@@ -77,54 +125,118 @@ func bin() string {
 		"google-chrome-unstable",
 	} {
 		if _, err := exec.LookPath(path); err == nil {
-			return path
+			return path, nil
 		}
 	}
-	panic("chrome binary not found")
+	return "", ErrBinaryNotFound
+}
+
+// MaxTimeToStart is the time Launch waits for the browser to start listening
+var MaxTimeToStart = DefaultStartTimeout
+
+// Launch starts the browser with the additional command line flags, see LaunchWithOptions
+func Launch(ctx context.Context, flags ...string) (Chrome, error) {
+	return LaunchWithOptions(ctx, Options{Flags: flags, StartTimeout: MaxTimeToStart})
 }
 
-func Launch(ctx context.Context, userFlags ...string) (value Chrome, err error) {
-	// https://github.com/GoogleChrome/chrome-launcher/blob/master/docs/chrome-flags-for-tools.md
-	// https://docs.google.com/spreadsheets/d/1n-vw_PCPS45jX3Jt9jQaAhFqBY6Ge1vWF_Pa0k7dCk4/edit#gid=1265672696
-	var flags = []string{"--remote-debugging-port=0"}
-	if os.Getuid() == 0 {
-		flags = append(flags, "--no-sandbox", "--disable-setuid-sandbox")
+// LaunchWithOptions starts the browser, if there is no user data dir or profile in options the temporary one is created
+func LaunchWithOptions(ctx context.Context, options Options) (value Chrome, err error) {
+	binary, err := bin(options.Binary)
+	if err != nil {
+		return value, err
 	}
-	if len(userFlags) > 0 {
-		flags = append(flags, userFlags...)
+	value.process = &process{done: make(chan struct{})}
+	if !options.hasProfile() {
+		value.process.userDataDir, err = os.MkdirTemp("", "chrome-control-*")
+		if err != nil {
+			return value, errors.Join(err, errors.New("can't create temporary user data dir"))
+		}
+		options.UserDataDir = value.process.userDataDir
 	}
-	binary := bin()
-	value.StartArgs = fmt.Sprint(binary, strings.Join(flags, " "))
+	flags := options.flags()
+	value.StartArgs = fmt.Sprint(binary, " ", strings.Join(flags, " "))
 	value.cmd = exec.CommandContext(ctx, binary, flags...)
+	value.cmd.Stdout = options.Stdout
+	if len(options.Env) > 0 {
+		value.cmd.Env = append(os.Environ(), options.Env...)
+	}
+	setProcessGroup(value.cmd)
 
-	stderr, err := value.cmd.StderrPipe()
-	if err != nil {
-		return value, err
+	if options.isPipe() {
+		value.cmd.Stderr = options.Stderr
+		if err = value.startPipe(); err != nil {
+			return value, errors.Join(err, value.removeUserDataDir())
+		}
+		go value.reap()
+		return value, nil
 	}
 
-	addr := make(chan string)
-	var std []string
+	var (
+		stderr, stderrWriter = io.Pipe()
+		addr                 = make(chan string, 1)
+		std                  = make(chan []string, 1)
+		sink                 = options.Stderr
+	)
+	if sink == nil {
+		sink = io.Discard
+	}
+	value.cmd.Stderr = stderrWriter
 	go func() {
 		const prefix = "DevTools listening on"
-		var scanner = bufio.NewScanner(stderr)
+		var (
+			scanner = bufio.NewScanner(stderr)
+			lines   []string
+		)
 		for scanner.Scan() {
 			line := scanner.Text()
-			std = append(std, line)
+			lines = append(lines, line)
+			_, _ = fmt.Fprintln(sink, line)
 			if s := strings.TrimPrefix(line, prefix); s != line {
 				addr <- strings.TrimSpace(s)
+				// keep reading, the browser blocks on the full stderr pipe
+				_, _ = io.Copy(sink, stderr)
 				return
 			}
 		}
+		std <- lines
 	}()
 
 	if err = value.cmd.Start(); err != nil {
-		return value, err
+		return value, errors.Join(err, value.removeUserDataDir())
 	}
+	go func() {
+		value.reap()
+		_ = stderrWriter.Close()
+	}()
 
 	select {
 	case value.WebSocketUrl = <-addr:
 		return value, nil
-	case <-time.After(MaxTimeToStart):
-		return value, fmt.Errorf("chrome stopped too early %s", strings.Join(std, "\n"))
+	case lines := <-std:
+		return value, errors.Join(fmt.Errorf("chrome stopped too early %s", strings.Join(lines, "\n")), value.Kill())
+	case <-time.After(options.startTimeout()):
+		return value, errors.Join(fmt.Errorf("chrome didn't start in %s", options.startTimeout()), value.Kill())
+	}
+}
+
+func (c *Chrome) startPipe() (err error) {
+	// the browser reads commands from fd 3 and writes responses to fd 4
+	commandsReader, commandsWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	responsesReader, responsesWriter, err := os.Pipe()
+	if err != nil {
+		return errors.Join(err, commandsReader.Close(), commandsWriter.Close())
+	}
+	c.cmd.ExtraFiles = []*os.File{commandsReader, responsesWriter}
+	err = c.cmd.Start()
+	// the child's ends are inherited by the browser process
+	err = errors.Join(err, commandsReader.Close(), responsesWriter.Close())
+	if err != nil {
+		return errors.Join(err, commandsWriter.Close(), responsesReader.Close())
 	}
+	c.pipeReader = responsesReader
+	c.pipeWriter = commandsWriter
+	return nil
 }
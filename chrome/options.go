@@ -0,0 +1,109 @@
+package chrome
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const DefaultStartTimeout = 10 * time.Second
+
+type HeadlessMode string
+
+const (
+	Headful     HeadlessMode = ""
+	HeadlessNew HeadlessMode = "new"
+	HeadlessOld HeadlessMode = "old"
+)
+
+type Options struct {
+	// Binary is a path to the browser executable, CHROME_PATH env variable or well-known locations are used if empty
+	Binary      string
+	Headless    HeadlessMode
+	WindowWidth int
+	// WindowHeight is used together with WindowWidth
+	WindowHeight int
+	// Proxy server, e.g. `http://127.0.0.1:8080` or `socks5://127.0.0.1:1080`
+	Proxy       string
+	UserDataDir string
+	// Env is appended to the environment of the current process
+	Env []string
+	// Extensions are paths to the unpacked extensions to load
+	Extensions []string
+	// Pipe starts the browser with DevTools protocol over pipes instead of websocket (same as PipeFlag)
+	Pipe bool
+	// StartTimeout is a max time to wait for the browser to start listening, DefaultStartTimeout if zero
+	StartTimeout time.Duration
+	Stderr       io.Writer
+	Stdout       io.Writer
+	// Flags are the additional command line switches
+	Flags []string
+}
+
+func (o Options) flags() []string {
+	// https://github.com/GoogleChrome/chrome-launcher/blob/master/docs/chrome-flags-for-tools.md
+	// https://docs.google.com/spreadsheets/d/1n-vw_PCPS45jX3Jt9jQaAhFqBY6Ge1vWF_Pa0k7dCk4/edit#gid=1265672696
+	var flags []string
+	if o.isPipe() {
+		if !o.hasFlag(PipeFlag) {
+			flags = append(flags, PipeFlag)
+		}
+	} else {
+		flags = append(flags, "--remote-debugging-port=0")
+	}
+	if os.Getuid() == 0 {
+		flags = append(flags, "--no-sandbox", "--disable-setuid-sandbox")
+	}
+	if o.Headless != Headful {
+		flags = append(flags, "--headless="+string(o.Headless))
+	}
+	if o.WindowWidth > 0 && o.WindowHeight > 0 {
+		flags = append(flags, fmt.Sprintf("--window-size=%d,%d", o.WindowWidth, o.WindowHeight))
+	}
+	if o.Proxy != "" {
+		flags = append(flags, "--proxy-server="+o.Proxy)
+	}
+	if o.UserDataDir != "" {
+		flags = append(flags, "--user-data-dir="+o.UserDataDir)
+	}
+	if len(o.Extensions) > 0 {
+		extensions := strings.Join(o.Extensions, ",")
+		flags = append(flags, "--load-extension="+extensions, "--disable-extensions-except="+extensions)
+	}
+	return append(flags, o.Flags...)
+}
+
+func (o Options) hasFlag(flag string) bool {
+	for _, f := range o.Flags {
+		if f == flag || strings.HasPrefix(f, flag+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+func (o Options) hasProfile() bool {
+	if o.UserDataDir != "" {
+		return true
+	}
+	for _, f := range o.Flags {
+		f = strings.TrimSpace(f)
+		if strings.HasPrefix(f, "--profile-directory") || strings.HasPrefix(f, "--user-data-dir") {
+			return true
+		}
+	}
+	return false
+}
+
+func (o Options) isPipe() bool {
+	return o.Pipe || o.hasFlag(PipeFlag)
+}
+
+func (o Options) startTimeout() time.Duration {
+	if o.StartTimeout > 0 {
+		return o.StartTimeout
+	}
+	return DefaultStartTimeout
+}
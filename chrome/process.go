@@ -0,0 +1,74 @@
+package chrome
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// KillGracePeriod is a time given to the browser to exit after SIGTERM before SIGKILL
+var KillGracePeriod = 3 * time.Second
+
+type process struct {
+	done chan struct{}
+	err  error
+	// temporary user data dir created by Launch
+	userDataDir string
+}
+
+func (c Chrome) reap() {
+	c.process.err = c.cmd.Wait()
+	close(c.process.done)
+}
+
+func (c Chrome) exited() bool {
+	select {
+	case <-c.process.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait waits for the browser process to exit
+func (c Chrome) Wait() error {
+	<-c.process.done
+	return c.process.err
+}
+
+// Kill sends SIGKILL to the browser and all its child processes, then removes the temporary user data dir.
+// The group is killed even if the browser has exited, zygote and renderers may outlive it
+func (c Chrome) Kill() error {
+	if err := killGroup(c.cmd.Process); err != nil && !c.exited() {
+		return err
+	}
+	<-c.process.done
+	return c.removeUserDataDir()
+}
+
+// Shutdown waits until the browser exits after Browser.close was sent or ctx is done,
+// then terminates the whole process group with SIGTERM and SIGKILL after KillGracePeriod.
+// Leftover processes of the group are killed and the temporary user data dir is removed in any case.
+func (c Chrome) Shutdown(ctx context.Context) error {
+	select {
+	case <-c.process.done:
+		return c.Kill()
+	case <-ctx.Done():
+	}
+	if err := terminateGroup(c.cmd.Process); err != nil && !c.exited() {
+		return errors.Join(err, c.Kill())
+	}
+	select {
+	case <-c.process.done:
+	case <-time.After(KillGracePeriod):
+	}
+	return c.Kill()
+}
+
+func (c Chrome) removeUserDataDir() error {
+	if c.process.userDataDir == "" {
+		return nil
+	}
+	return os.RemoveAll(c.process.userDataDir)
+}
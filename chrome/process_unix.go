@@ -0,0 +1,31 @@
+//go:build !windows
+
+package chrome
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func signalGroup(p *os.Process, signal syscall.Signal) error {
+	// negative pid sends the signal to every process of the group
+	err := syscall.Kill(-p.Pid, signal)
+	if errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+	return err
+}
+
+func terminateGroup(p *os.Process) error {
+	return signalGroup(p, syscall.SIGTERM)
+}
+
+func killGroup(p *os.Process) error {
+	return signalGroup(p, syscall.SIGKILL)
+}
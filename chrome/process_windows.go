@@ -0,0 +1,24 @@
+//go:build windows
+
+package chrome
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// there is no SIGTERM on windows, the browser is killed
+func terminateGroup(p *os.Process) error {
+	return killGroup(p)
+}
+
+func killGroup(p *os.Process) error {
+	err := p.Kill()
+	if errors.Is(err, os.ErrProcessDone) {
+		return nil
+	}
+	return err
+}
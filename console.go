@@ -0,0 +1,375 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ecwid/control/cdp"
+	"github.com/ecwid/control/protocol/log"
+	"github.com/ecwid/control/protocol/runtime"
+)
+
+type Location struct {
+	URL    string
+	Line   int
+	Column int
+}
+
+// ConsoleMessage is a call of console API or a browser log entry (network errors, violations, deprecations)
+type ConsoleMessage struct {
+	// Level is the console method (log, debug, info, error, warning, table, trace, ...) or the log entry level (verbose, info, warning, error)
+	Level string
+	// Source is `console-api` for the console calls or the source of the log entry (network, violation, ...)
+	Source     string
+	Text       string
+	Args       []any
+	Location   Location
+	StackTrace *runtime.StackTrace
+	Frame      *Frame
+	Timestamp  time.Time
+}
+
+// PageError is an uncaught exception of the page
+type PageError struct {
+	JSError
+	Location   Location
+	StackTrace *runtime.StackTrace
+	Frame      *Frame
+	Timestamp  time.Time
+}
+
+type consoleHub struct {
+	mutex          sync.Mutex
+	seq            int
+	consoleHandler []consoleHandler[ConsoleMessage]
+	errorHandler   []consoleHandler[PageError]
+	bufferSize     int
+	messages       []ConsoleMessage
+	errors         []PageError
+	cancel         func()
+	// queue holds events to resolve and dispatch, it's drained by dispatchConsoleQueue
+	queue   []cdp.Message
+	pending chan struct{}
+}
+
+type consoleHandler[T any] struct {
+	id      int
+	handler func(T)
+}
+
+// OnConsole calls the handler for each console message in order they are logged
+func (s *Session) OnConsole(handler func(ConsoleMessage)) (cancel func(), err error) {
+	return s.onConsole(func(h *consoleHub, id int) {
+		h.consoleHandler = append(h.consoleHandler, consoleHandler[ConsoleMessage]{id: id, handler: handler})
+	})
+}
+
+func (s *Session) MustOnConsole(handler func(ConsoleMessage)) (cancel func()) {
+	cancel, err := s.OnConsole(handler)
+	if err != nil {
+		panic(err)
+	}
+	return cancel
+}
+
+// OnPageError calls the handler for each uncaught exception of the page
+func (s *Session) OnPageError(handler func(PageError)) (cancel func(), err error) {
+	return s.onConsole(func(h *consoleHub, id int) {
+		h.errorHandler = append(h.errorHandler, consoleHandler[PageError]{id: id, handler: handler})
+	})
+}
+
+func (s *Session) MustOnPageError(handler func(PageError)) (cancel func()) {
+	cancel, err := s.OnPageError(handler)
+	if err != nil {
+		panic(err)
+	}
+	return cancel
+}
+
+func (s *Session) onConsole(add func(*consoleHub, int)) (func(), error) {
+	h := s.console
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if err := s.listenConsole(); err != nil {
+		return nil, err
+	}
+	h.seq++
+	id := h.seq
+	add(h, id)
+	return func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		h.consoleHandler = removeConsoleHandler(h.consoleHandler, id)
+		h.errorHandler = removeConsoleHandler(h.errorHandler, id)
+	}, nil
+}
+
+func removeConsoleHandler[T any](handlers []consoleHandler[T], id int) []consoleHandler[T] {
+	for n, value := range handlers {
+		if value.id == id {
+			return append(handlers[:n:n], handlers[n+1:]...)
+		}
+	}
+	return handlers
+}
+
+// KeepConsole keeps the last size console messages and page errors in memory, 0 stops keeping them
+func (s *Session) KeepConsole(size int) error {
+	h := s.console
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.bufferSize = size
+	h.messages = trimBuffer(h.messages, size)
+	h.errors = trimBuffer(h.errors, size)
+	if size == 0 {
+		return nil
+	}
+	return s.listenConsole()
+}
+
+func (s *Session) MustKeepConsole(size int) {
+	panicIfError(s.KeepConsole(size))
+}
+
+// ConsoleMessages returns messages kept since KeepConsole call
+func (s *Session) ConsoleMessages() []ConsoleMessage {
+	s.console.mutex.Lock()
+	defer s.console.mutex.Unlock()
+	return append([]ConsoleMessage(nil), s.console.messages...)
+}
+
+// PageErrors returns errors kept since KeepConsole call
+func (s *Session) PageErrors() []PageError {
+	s.console.mutex.Lock()
+	defer s.console.mutex.Unlock()
+	return append([]PageError(nil), s.console.errors...)
+}
+
+func trimBuffer[T any](buffer []T, size int) []T {
+	if len(buffer) > size {
+		return append(buffer[:0:0], buffer[len(buffer)-size:]...)
+	}
+	return buffer
+}
+
+// listenConsole starts the subscription once, the caller must hold the lock
+func (s *Session) listenConsole() error {
+	if s.console.cancel != nil {
+		return nil
+	}
+	channel, cancel := s.Subscribe()
+	s.console.pending = make(chan struct{}, 1)
+	go s.handleConsole(channel)
+	go s.dispatchConsoleQueue()
+	if err := log.Enable(s); err != nil {
+		cancel()
+		return err
+	}
+	s.console.cancel = cancel
+	return nil
+}
+
+// handleConsole queues console events, arguments are resolved by dispatchConsoleQueue
+// so CDP calls don't block the subscription while the page is paused, e.g. by a dialog
+func (s *Session) handleConsole(channel chan cdp.Message) {
+	for message := range channel {
+		switch message.Method {
+		case "Runtime.consoleAPICalled", "Log.entryAdded", "Runtime.exceptionThrown":
+		default:
+			continue
+		}
+		h := s.console
+		h.mutex.Lock()
+		h.queue = append(h.queue, message)
+		h.mutex.Unlock()
+		select {
+		case h.pending <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// dispatchConsoleQueue resolves messages one by one to keep their order
+func (s *Session) dispatchConsoleQueue() {
+	h := s.console
+	for {
+		select {
+		case <-h.pending:
+		case <-s.context.Done():
+			return
+		}
+		for {
+			h.mutex.Lock()
+			if len(h.queue) == 0 {
+				h.mutex.Unlock()
+				break
+			}
+			message := h.queue[0]
+			h.queue = h.queue[1:]
+			h.mutex.Unlock()
+			s.dispatchConsoleEvent(message)
+		}
+	}
+}
+
+func (s *Session) dispatchConsoleEvent(message cdp.Message) {
+	switch message.Method {
+	case "Runtime.consoleAPICalled":
+		var called runtime.ConsoleAPICalled
+		if err := json.Unmarshal(message.Params, &called); err == nil {
+			s.dispatchConsole(s.newConsoleMessage(called))
+		}
+	case "Log.entryAdded":
+		var added log.EntryAdded
+		if err := json.Unmarshal(message.Params, &added); err == nil && added.Entry != nil {
+			s.dispatchConsole(s.newLogMessage(added.Entry))
+		}
+	case "Runtime.exceptionThrown":
+		var thrown runtime.ExceptionThrown
+		if err := json.Unmarshal(message.Params, &thrown); err == nil && thrown.ExceptionDetails != nil {
+			s.dispatchPageError(s.newPageError(thrown))
+		}
+	}
+}
+
+func (s *Session) dispatchConsole(message ConsoleMessage) {
+	h := s.console
+	h.mutex.Lock()
+	if h.bufferSize > 0 {
+		h.messages = trimBuffer(append(h.messages, message), h.bufferSize)
+	}
+	var handlers = append([]consoleHandler[ConsoleMessage](nil), h.consoleHandler...)
+	h.mutex.Unlock()
+	for _, value := range handlers {
+		value.handler(message)
+	}
+}
+
+func (s *Session) dispatchPageError(pageError PageError) {
+	h := s.console
+	h.mutex.Lock()
+	if h.bufferSize > 0 {
+		h.errors = trimBuffer(append(h.errors, pageError), h.bufferSize)
+	}
+	var handlers = append([]consoleHandler[PageError](nil), h.errorHandler...)
+	h.mutex.Unlock()
+	for _, value := range handlers {
+		value.handler(pageError)
+	}
+}
+
+func (s *Session) frameByContext(id runtime.ExecutionContextId) *Frame {
+	if frameID, ok := s.frames.frameByContext(id); ok {
+		return &Frame{session: s, id: frameID}
+	}
+	return s.Frame
+}
+
+func (s *Session) newConsoleMessage(called runtime.ConsoleAPICalled) ConsoleMessage {
+	message := ConsoleMessage{
+		Level:      called.Type,
+		Source:     "console-api",
+		StackTrace: called.StackTrace,
+		Frame:      s.frameByContext(called.ExecutionContextId),
+		Timestamp:  toTime(called.Timestamp),
+		Location:   stackLocation(called.StackTrace),
+	}
+	var text = make([]string, len(called.Args))
+	for n, arg := range called.Args {
+		text[n] = describeConsoleArg(arg)
+		value, err := message.Frame.resolveConsoleArg(arg)
+		if err != nil {
+			value = arg.Description
+		}
+		message.Args = append(message.Args, value)
+	}
+	message.Text = strings.Join(text, " ")
+	return message
+}
+
+func (s *Session) newLogMessage(entry *log.LogEntry) ConsoleMessage {
+	message := ConsoleMessage{
+		Level:      entry.Level,
+		Source:     entry.Source,
+		Text:       entry.Text,
+		StackTrace: entry.StackTrace,
+		Frame:      s.Frame,
+		Timestamp:  toTime(entry.Timestamp),
+		Location:   Location{URL: entry.Url, Line: entry.LineNumber},
+	}
+	for _, arg := range entry.Args {
+		value, err := s.Frame.resolveConsoleArg(arg)
+		if err != nil {
+			value = arg.Description
+		}
+		message.Args = append(message.Args, value)
+	}
+	return message
+}
+
+func (s *Session) newPageError(thrown runtime.ExceptionThrown) PageError {
+	details := thrown.ExceptionDetails
+	pageError := PageError{
+		StackTrace: details.StackTrace,
+		Frame:      s.frameByContext(details.ExecutionContextId),
+		Timestamp:  toTime(thrown.Timestamp),
+		Location:   Location{URL: details.Url, Line: details.LineNumber, Column: details.ColumnNumber},
+	}
+	switch exception := details.Exception; {
+	case exception == nil:
+		pageError.Name, pageError.Message = "Error", details.Text
+	case exception.Subtype == "error" && exception.Description != "":
+		// description of Error is its stack: `TypeError: message\n    at ...`
+		first, _, _ := strings.Cut(exception.Description, "\n")
+		name, message, _ := strings.Cut(first, ": ")
+		pageError.JSError = JSError{Name: name, Message: message, Stack: exception.Description}
+	default:
+		pageError.Name, pageError.Message = "Error", "Uncaught "+describeConsoleArg(exception)
+	}
+	return pageError
+}
+
+// resolveConsoleArg unserializes the object argument by its handle, primitives are passed by value
+func (f *Frame) resolveConsoleArg(arg *runtime.RemoteObject) (any, error) {
+	if arg.ObjectId == "" {
+		if arg.UnserializableValue != "" {
+			return unserializeNumber(string(arg.UnserializableValue))
+		}
+		return arg.Value, nil
+	}
+	return f.CallFunctionOn(remoteObjectValue(arg.ObjectId), `function(){return this}`, false)
+}
+
+// describeConsoleArg formats the argument like DevTools console does
+func describeConsoleArg(arg *runtime.RemoteObject) string {
+	switch {
+	case arg.Type == "string":
+		return fmt.Sprint(arg.Value)
+	case arg.UnserializableValue != "":
+		return string(arg.UnserializableValue)
+	case arg.Description != "":
+		return arg.Description
+	case arg.Type == "undefined":
+		return "undefined"
+	default:
+		b, _ := json.Marshal(arg.Value)
+		return string(b)
+	}
+}
+
+func stackLocation(stack *runtime.StackTrace) Location {
+	if stack == nil || len(stack.CallFrames) == 0 {
+		return Location{}
+	}
+	top := stack.CallFrames[0]
+	return Location{URL: top.Url, Line: top.LineNumber, Column: top.ColumnNumber}
+}
+
+// toTime converts protocol timestamp in milliseconds since epoch
+func toTime(timestamp runtime.Timestamp) time.Time {
+	return time.UnixMicro(int64(float64(timestamp) * 1000))
+}
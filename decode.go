@@ -0,0 +1,291 @@
+package control
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// DecodeError is returned when JS value can't be decoded into Go type, Path points to the value like `$.items[2].name`
+type DecodeError struct {
+	Path  string
+	Value any
+	Type  reflect.Type
+}
+
+func (d DecodeError) Error() string {
+	return fmt.Sprintf("can't decode %T at `%s` into %s", d.Value, d.Path, d.Type)
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// EvaluateAs evaluates the expression awaiting the promise and decodes the result into T
+func EvaluateAs[T any](frame *Frame, expression string) Optional[T] {
+	value, err := frame.evaluate(expression, true)
+	if err != nil {
+		return Optional[T]{err: err}
+	}
+	return decodeAs[T](value)
+}
+
+func MustEvaluateAs[T any](frame *Frame, expression string) T {
+	return EvaluateAs[T](frame, expression).MustGetValue()
+}
+
+// CallAs calls the function on the node and decodes the result into T
+func CallAs[T any](node *Node, function string, args ...any) Optional[T] {
+	value, err := node.eval(function, args...)
+	if err != nil {
+		return Optional[T]{err: err}
+	}
+	return decodeAs[T](value)
+}
+
+func MustCallAs[T any](node *Node, function string, args ...any) T {
+	return CallAs[T](node, function, args...).MustGetValue()
+}
+
+func decodeAs[T any](value any) Optional[T] {
+	var result T
+	if err := decode("$", value, reflect.ValueOf(&result).Elem()); err != nil {
+		return Optional[T]{err: err}
+	}
+	return Optional[T]{value: result}
+}
+
+// decode assigns unserialized JS value to dst converting maps, slices and numbers to the dst type,
+// struct fields are matched by json tags or by names case-insensitively like encoding/json does
+func decode(path string, value any, dst reflect.Value) error {
+	if value == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	src := reflect.ValueOf(value)
+	if src.Type().AssignableTo(dst.Type()) {
+		dst.Set(src)
+		return nil
+	}
+	if dst.Kind() == reflect.Pointer {
+		ptr := reflect.New(dst.Type().Elem())
+		if err := decode(path, value, ptr.Elem()); err != nil {
+			return err
+		}
+		dst.Set(ptr)
+		return nil
+	}
+	if dst.Type() == timeType {
+		return decodeTime(path, value, dst)
+	}
+	if dst.Addr().Type().Implements(unmarshalerType) {
+		b, err := json.Marshal(value)
+		if err == nil {
+			err = dst.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(b)
+		}
+		if err != nil {
+			return fmt.Errorf("can't decode %T at `%s` into %s: %w", value, path, dst.Type(), err)
+		}
+		return nil
+	}
+	mismatch := DecodeError{Path: path, Value: value, Type: dst.Type()}
+
+	switch dst.Kind() {
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return mismatch
+		}
+		dst.SetBool(b)
+
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return mismatch
+		}
+		dst.SetString(s)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := value.(*big.Int); ok {
+			if !n.IsInt64() || dst.OverflowInt(n.Int64()) {
+				return mismatch
+			}
+			dst.SetInt(n.Int64())
+			return nil
+		}
+		f, ok := value.(float64)
+		if !ok || f != math.Trunc(f) || dst.OverflowInt(int64(f)) {
+			return mismatch
+		}
+		dst.SetInt(int64(f))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, ok := value.(*big.Int); ok {
+			if !n.IsUint64() || dst.OverflowUint(n.Uint64()) {
+				return mismatch
+			}
+			dst.SetUint(n.Uint64())
+			return nil
+		}
+		f, ok := value.(float64)
+		if !ok || f < 0 || f != math.Trunc(f) || dst.OverflowUint(uint64(f)) {
+			return mismatch
+		}
+		dst.SetUint(uint64(f))
+
+	case reflect.Float32, reflect.Float64:
+		f, ok := value.(float64)
+		if !ok {
+			return mismatch
+		}
+		dst.SetFloat(f)
+
+	case reflect.Slice:
+		if s, ok := value.(string); ok && dst.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return mismatch
+			}
+			dst.SetBytes(b)
+			return nil
+		}
+		arr, ok := value.([]any)
+		if !ok {
+			return mismatch
+		}
+		slice := reflect.MakeSlice(dst.Type(), len(arr), len(arr))
+		for n, e := range arr {
+			if err := decode(fmt.Sprintf("%s[%d]", path, n), e, slice.Index(n)); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+
+	case reflect.Array:
+		arr, ok := value.([]any)
+		if !ok || len(arr) != dst.Len() {
+			return mismatch
+		}
+		for n, e := range arr {
+			if err := decode(fmt.Sprintf("%s[%d]", path, n), e, dst.Index(n)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if entries, ok := value.(OrderedMap); ok {
+			return decodeOrderedMap(path, entries, dst)
+		}
+		obj, ok := value.(map[string]any)
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return mismatch
+		}
+		m := reflect.MakeMapWithSize(dst.Type(), len(obj))
+		for k, e := range obj {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := decode(path+"."+k, e, elem); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), elem)
+		}
+		dst.Set(m)
+
+	case reflect.Struct:
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return mismatch
+		}
+		return decodeStruct(path, obj, dst)
+
+	default:
+		return mismatch
+	}
+	return nil
+}
+
+func decodeOrderedMap(path string, entries OrderedMap, dst reflect.Value) error {
+	m := reflect.MakeMapWithSize(dst.Type(), len(entries))
+	for n, entry := range entries {
+		key := reflect.New(dst.Type().Key()).Elem()
+		if err := decode(fmt.Sprintf("%s.keys()[%d]", path, n), entry.Key, key); err != nil {
+			return err
+		}
+		elem := reflect.New(dst.Type().Elem()).Elem()
+		if err := decode(fmt.Sprintf("%s.get(%v)", path, entry.Key), entry.Value, elem); err != nil {
+			return err
+		}
+		m.SetMapIndex(key, elem)
+	}
+	dst.Set(m)
+	return nil
+}
+
+func decodeStruct(path string, obj map[string]any, dst reflect.Value) error {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			if !field.IsExported() {
+				continue // fields of unexported embedded struct can't be set
+			}
+			if err := decodeStruct(path, obj, dst.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		key, value, ok := lookupKey(obj, name)
+		if !ok {
+			continue
+		}
+		if err := decode(path+"."+key, value, dst.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupKey prefers the exact match of the key and falls back to case-insensitive one
+func lookupKey(obj map[string]any, name string) (string, any, bool) {
+	if value, ok := obj[name]; ok {
+		return name, value, true
+	}
+	for key, value := range obj {
+		if strings.EqualFold(key, name) {
+			return key, value, true
+		}
+	}
+	return "", nil, false
+}
+
+// decodeTime accepts RFC 3339 string or number of milliseconds since epoch
+func decodeTime(path string, value any, dst reflect.Value) error {
+	switch typed := value.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, typed)
+		if err != nil {
+			return DecodeError{Path: path, Value: value, Type: dst.Type()}
+		}
+		dst.Set(reflect.ValueOf(t))
+	case float64:
+		dst.Set(reflect.ValueOf(time.UnixMilli(int64(typed))))
+	default:
+		return DecodeError{Path: path, Value: value, Type: dst.Type()}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ecwid/control/protocol/page"
+)
+
+const (
+	DialogAlert        page.DialogType = "alert"
+	DialogConfirm      page.DialogType = "confirm"
+	DialogPrompt       page.DialogType = "prompt"
+	DialogBeforeUnload page.DialogType = "beforeunload"
+)
+
+var ErrDialogAlreadyHandled = errors.New("dialog is already handled")
+
+// DialogAction closes the dialog, PromptText is the answer to prompt
+type DialogAction struct {
+	Accept     bool
+	PromptText string
+}
+
+var (
+	DialogAccept  = DialogAction{Accept: true}
+	DialogDismiss = DialogAction{Accept: false}
+)
+
+// DialogAnswer accepts prompt with the text
+func DialogAnswer(text string) DialogAction {
+	return DialogAction{Accept: true, PromptText: text}
+}
+
+// Dialog is JavaScript alert, confirm, prompt or beforeunload dialog, the page is blocked until it's closed
+type Dialog struct {
+	Type          page.DialogType
+	Message       string
+	DefaultPrompt string
+	URL           string
+	session       *Session
+	handled       *atomic.Bool
+}
+
+func (d Dialog) Call(method string, send, recv any) error {
+	return d.session.Call(method, send, recv)
+}
+
+// Handle closes the dialog, only the first call has effect
+func (d Dialog) Handle(action DialogAction) error {
+	if !d.handled.CompareAndSwap(false, true) {
+		return ErrDialogAlreadyHandled
+	}
+	return page.HandleJavaScriptDialog(d, page.HandleJavaScriptDialogArgs{
+		Accept:     action.Accept,
+		PromptText: action.PromptText,
+	})
+}
+
+func (d Dialog) Accept(promptText string) error {
+	return d.Handle(DialogAction{Accept: true, PromptText: promptText})
+}
+
+func (d Dialog) Dismiss() error {
+	return d.Handle(DialogDismiss)
+}
+
+type dialogHandlers struct {
+	mutex    sync.Mutex
+	seq      int
+	handlers []dialogHandler
+	waiters  []chan *Dialog
+	fallback DialogAction
+}
+
+type dialogHandler struct {
+	id      int
+	handler func(Dialog) DialogAction
+}
+
+// OnDialog sets the handler of dialogs, the latest one is called until its cancel
+func (s *Session) OnDialog(handler func(Dialog) DialogAction) (cancel func()) {
+	h := s.dialogs
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.seq++
+	id := h.seq
+	h.handlers = append(h.handlers, dialogHandler{id: id, handler: handler})
+	return func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		for n, value := range h.handlers {
+			if value.id == id {
+				h.handlers = append(h.handlers[:n], h.handlers[n+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// SetDefaultDialogAction sets the action for dialogs without handler and waiter, dialogs are dismissed by default
+func (s *Session) SetDefaultDialogAction(action DialogAction) {
+	s.dialogs.mutex.Lock()
+	defer s.dialogs.mutex.Unlock()
+	s.dialogs.fallback = action
+}
+
+// WaitForDialog calls trigger and returns the dialog it opened, the caller must Accept or Dismiss it.
+// The trigger runs in background since a dialog blocks the page and the calls awaiting it
+func (s *Session) WaitForDialog(trigger func() error) (dialog *Dialog, err error) {
+	waiter := make(chan *Dialog, 1)
+	h := s.dialogs
+	h.mutex.Lock()
+	h.waiters = append(h.waiters, waiter)
+	h.mutex.Unlock()
+	defer func() {
+		if dialog != nil {
+			return
+		}
+		h.mutex.Lock()
+		for n, value := range h.waiters {
+			if value == waiter {
+				h.waiters = append(h.waiters[:n], h.waiters[n+1:]...)
+				h.mutex.Unlock()
+				return
+			}
+		}
+		// the dialog was handed off while the wait was failing, nobody else closes it
+		action := h.fallback
+		h.mutex.Unlock()
+		s.closeDialog(<-waiter, action)
+	}()
+
+	var triggered = make(chan error, 1)
+	go func() { triggered <- trigger() }()
+	ctx, cancel := context.WithTimeout(s.context, s.timeout)
+	defer cancel()
+	for {
+		select {
+		case dialog := <-waiter:
+			return dialog, nil
+		case err := <-triggered:
+			if err != nil {
+				return nil, err
+			}
+			triggered = nil
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		}
+	}
+}
+
+func (s *Session) MustWaitForDialog(trigger func() error) *Dialog {
+	value, err := s.WaitForDialog(trigger)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// handleDialog passes the dialog to the first waiter, to the latest handler or closes it with the default action
+func (s *Session) handleDialog(opening page.JavascriptDialogOpening) {
+	dialog := &Dialog{
+		Type:          opening.Type,
+		Message:       opening.Message,
+		DefaultPrompt: opening.DefaultPrompt,
+		URL:           opening.Url,
+		session:       s,
+		handled:       &atomic.Bool{},
+	}
+	h := s.dialogs
+	h.mutex.Lock()
+	if len(h.waiters) > 0 {
+		// claimed and handed off under the lock, the buffered waiter doesn't block
+		h.waiters[0] <- dialog
+		h.waiters = h.waiters[1:]
+		h.mutex.Unlock()
+		return
+	}
+	var (
+		handler func(Dialog) DialogAction
+		action  = h.fallback
+	)
+	if len(h.handlers) > 0 {
+		handler = h.handlers[len(h.handlers)-1].handler
+	}
+	h.mutex.Unlock()
+
+	if handler != nil {
+		if err := dialog.Handle(handler(*dialog)); err != nil && err != ErrDialogAlreadyHandled {
+			s.Log("can't handle dialog", err, "type", dialog.Type)
+		}
+		return
+	}
+	s.closeDialog(dialog, action)
+}
+
+// closeDialog closes the dialog nobody handles with the default action
+func (s *Session) closeDialog(dialog *Dialog, action DialogAction) {
+	s.Log("dialog is closed by default action", "type", dialog.Type, "message", dialog.Message, "accept", action.Accept)
+	if err := dialog.Handle(action); err != nil && err != ErrDialogAlreadyHandled {
+		s.Log("can't handle dialog", err, "type", dialog.Type)
+	}
+}
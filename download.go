@@ -0,0 +1,370 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ecwid/control/cdp"
+	"github.com/ecwid/control/protocol"
+	"github.com/ecwid/control/protocol/browser"
+	"github.com/ecwid/control/protocol/common"
+	"github.com/ecwid/control/protocol/target"
+)
+
+const (
+	DownloadInProgress = "inProgress"
+	DownloadCompleted  = "completed"
+	DownloadCanceled   = "canceled"
+)
+
+var ErrDownloadCanceled = errors.New("download canceled")
+
+// Download is a file downloaded by the page, the completed file is moved into the temporary directory of the session
+// which is removed when the session is done
+type Download struct {
+	SuggestedFilename string
+	URL               string
+	FrameID           common.FrameId
+	guid              string
+	path              string
+	session           *Session
+	browserContextID  common.BrowserContextID
+	mutex             sync.Mutex
+	receivedBytes     float64
+	totalBytes        float64
+	state             string
+	done              chan struct{}
+}
+
+type downloadManager struct {
+	mutex sync.Mutex
+	// dir is the session's directory, downloads are written to the directory of the browser context first
+	dir              string
+	contextDir       string
+	browserContextID common.BrowserContextID
+	downloads        map[string]*Download
+	waiters          []chan *Download
+	cancel           func()
+}
+
+// downloadScope is the browser context, download behavior can't be set per page,
+// so sessions of the context share the directory Chrome downloads to
+type downloadScope struct {
+	transport        *cdp.Transport
+	browserContextID common.BrowserContextID
+}
+
+type downloadDir struct {
+	path string
+	refs int
+}
+
+var (
+	downloadDirsMutex sync.Mutex
+	downloadDirs      = map[downloadScope]*downloadDir{}
+	// downloadBehaviors are set by BrowserContext.SetDownloadBehavior and Session.SetDownloadBehavior,
+	// they are restored when the last session stops expecting downloads
+	downloadBehaviors = map[downloadScope]browser.SetDownloadBehaviorArgs{}
+)
+
+// Progress returns received bytes, total bytes (0 if unknown) and the state: inProgress, completed or canceled
+func (d *Download) Progress() (receivedBytes, totalBytes int64, state string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return int64(d.receivedBytes), int64(d.totalBytes), d.state
+}
+
+// Wait blocks until the download is completed or canceled
+func (d *Download) Wait(ctx context.Context) error {
+	select {
+	case <-d.done:
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case <-d.session.context.Done():
+		return context.Cause(d.session.context)
+	}
+	if _, _, state := d.Progress(); state == DownloadCanceled {
+		return ErrDownloadCanceled
+	}
+	return nil
+}
+
+func (d *Download) MustWait(ctx context.Context) {
+	panicIfError(d.Wait(ctx))
+}
+
+// Path waits for the download and returns the path of the file in the temporary directory of the session
+func (d *Download) Path() (string, error) {
+	ctx, cancel := context.WithTimeout(d.session.context, d.session.timeout)
+	defer cancel()
+	if err := d.Wait(ctx); err != nil {
+		return "", err
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.path, nil
+}
+
+func (d *Download) MustPath() string {
+	value, err := d.Path()
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// SaveAs waits for the download and copies the file to the path
+func (d *Download) SaveAs(path string) error {
+	source, err := d.Path()
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func (d *Download) MustSaveAs(path string) {
+	panicIfError(d.SaveAs(path))
+}
+
+func (d *Download) Cancel() error {
+	return browser.CancelDownload(d.session.transport, browser.CancelDownloadArgs{
+		Guid:             d.guid,
+		BrowserContextId: d.browserContextID,
+	})
+}
+
+func (d *Download) MustCancel() {
+	panicIfError(d.Cancel())
+}
+
+// ExpectDownload calls trigger and returns the download it started, the download continues in background
+func (s *Session) ExpectDownload(trigger func() error) (*Download, error) {
+	if err := s.listenDownloads(); err != nil {
+		return nil, err
+	}
+	waiter := make(chan *Download, 1)
+	h := s.downloads
+	h.mutex.Lock()
+	h.waiters = append(h.waiters, waiter)
+	h.mutex.Unlock()
+	defer func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		for n, value := range h.waiters {
+			if value == waiter {
+				h.waiters = append(h.waiters[:n], h.waiters[n+1:]...)
+				return
+			}
+		}
+	}()
+	if err := trigger(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(s.context, s.timeout)
+	defer cancel()
+	select {
+	case download := <-waiter:
+		return download, nil
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
+func (s *Session) MustExpectDownload(trigger func() error) *Download {
+	value, err := s.ExpectDownload(trigger)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// listenDownloads creates the temporary directory of the session and allows downloads of its browser context once
+func (s *Session) listenDownloads() error {
+	h := s.downloads
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.cancel != nil {
+		return nil
+	}
+	info, err := target.GetTargetInfo(s, target.GetTargetInfoArgs{TargetId: s.targetID})
+	if err != nil {
+		return err
+	}
+	scope := downloadScope{transport: s.transport, browserContextID: info.TargetInfo.BrowserContextId}
+	dir, err := os.MkdirTemp("", "control-session-downloads-")
+	if err != nil {
+		return err
+	}
+	contextDir, err := acquireDownloadDir(scope)
+	if err != nil {
+		return errors.Join(err, os.RemoveAll(dir))
+	}
+	// browser-level events are delivered to every subscriber, they are filtered by frames of the session
+	channel, cancel := s.Subscribe()
+	go s.handleDownloads(channel)
+	context.AfterFunc(s.context, func() {
+		if err := errors.Join(releaseDownloadDir(scope), os.RemoveAll(dir)); err != nil {
+			s.Log("can't remove downloads directory", err, "dir", dir)
+		}
+	})
+	h.dir, h.contextDir, h.browserContextID, h.cancel = dir, contextDir, scope.browserContextID, cancel
+	return nil
+}
+
+// acquireDownloadDir creates the directory of the browser context for the first session and allows downloads into it
+func acquireDownloadDir(scope downloadScope) (string, error) {
+	downloadDirsMutex.Lock()
+	defer downloadDirsMutex.Unlock()
+	if dir, ok := downloadDirs[scope]; ok {
+		dir.refs++
+		return dir.path, nil
+	}
+	path, err := os.MkdirTemp("", "control-downloads-")
+	if err != nil {
+		return "", err
+	}
+	// files are named by guid to not collide, SaveAs gives them the name
+	err = browser.SetDownloadBehavior(scope.transport, browser.SetDownloadBehaviorArgs{
+		Behavior:         "allowAndName",
+		BrowserContextId: scope.browserContextID,
+		DownloadPath:     path,
+		EventsEnabled:    true,
+	})
+	if err != nil {
+		return "", errors.Join(err, os.RemoveAll(path))
+	}
+	downloadDirs[scope] = &downloadDir{path: path, refs: 1}
+	return path, nil
+}
+
+// releaseDownloadDir restores download behavior set by the user and removes the directory
+// after the last session of the browser context is done
+func releaseDownloadDir(scope downloadScope) error {
+	downloadDirsMutex.Lock()
+	defer downloadDirsMutex.Unlock()
+	dir := downloadDirs[scope]
+	if dir.refs--; dir.refs > 0 {
+		return nil
+	}
+	delete(downloadDirs, scope)
+	if scope.transport.Context().Err() == nil {
+		previous, ok := downloadBehaviors[scope]
+		if !ok {
+			previous = browser.SetDownloadBehaviorArgs{Behavior: "default"}
+		}
+		previous.BrowserContextId = scope.browserContextID
+		// the context may be disposed already, the error doesn't matter
+		_ = browser.SetDownloadBehavior(scope.transport, previous)
+	}
+	return os.RemoveAll(dir.path)
+}
+
+// setDownloadBehavior sets and remembers the behavior of the browser context to restore it after ExpectDownload,
+// the behavior set while downloads are expected takes effect immediately and may prevent them
+func setDownloadBehavior(caller protocol.Caller, scope downloadScope, args browser.SetDownloadBehaviorArgs) error {
+	downloadDirsMutex.Lock()
+	defer downloadDirsMutex.Unlock()
+	if err := browser.SetDownloadBehavior(caller, args); err != nil {
+		return err
+	}
+	downloadBehaviors[scope] = args
+	return nil
+}
+
+// forgetDownloadBehavior drops the behavior of the disposed browser context
+func forgetDownloadBehavior(scope downloadScope) {
+	downloadDirsMutex.Lock()
+	defer downloadDirsMutex.Unlock()
+	delete(downloadBehaviors, scope)
+}
+
+// ownsFrame reports whether the frame belongs to the session or its child sessions
+func (s *Session) ownsFrame(id common.FrameId) bool {
+	if _, ok := s.frames.get(id); ok || id == common.FrameId(s.targetID) {
+		return true
+	}
+	var owns bool
+	s.children.Range(func(_, value any) bool {
+		owns = value.(*Session).ownsFrame(id)
+		return !owns
+	})
+	return owns
+}
+
+func (s *Session) handleDownloads(channel chan cdp.Message) {
+	h := s.downloads
+	for message := range channel {
+		switch message.Method {
+		case "Browser.downloadWillBegin":
+			var begin browser.DownloadWillBegin
+			if err := json.Unmarshal(message.Params, &begin); err != nil || !s.ownsFrame(begin.FrameId) {
+				continue
+			}
+			h.mutex.Lock()
+			download := &Download{
+				SuggestedFilename: begin.SuggestedFilename,
+				URL:               begin.Url,
+				FrameID:           begin.FrameId,
+				guid:              begin.Guid,
+				path:              filepath.Join(h.contextDir, begin.Guid),
+				session:           s,
+				browserContextID:  h.browserContextID,
+				state:             DownloadInProgress,
+				done:              make(chan struct{}),
+			}
+			h.downloads[begin.Guid] = download
+			if len(h.waiters) > 0 {
+				h.waiters[0] <- download
+				h.waiters = h.waiters[1:]
+			}
+			h.mutex.Unlock()
+
+		case "Browser.downloadProgress":
+			var progress browser.DownloadProgress
+			if err := json.Unmarshal(message.Params, &progress); err != nil {
+				continue
+			}
+			h.mutex.Lock()
+			download, ok := h.downloads[progress.Guid]
+			if ok && progress.State != DownloadInProgress {
+				delete(h.downloads, progress.Guid)
+			}
+			h.mutex.Unlock()
+			if !ok {
+				continue
+			}
+			download.mutex.Lock()
+			download.receivedBytes, download.totalBytes, download.state = progress.ReceivedBytes, progress.TotalBytes, progress.State
+			if progress.State == DownloadCompleted {
+				path := filepath.Join(h.dir, progress.Guid)
+				if err := os.Rename(download.path, path); err != nil {
+					s.Log("can't move download to the session directory", err, "guid", progress.Guid)
+				} else {
+					download.path = path
+				}
+			}
+			download.mutex.Unlock()
+			if progress.State != DownloadInProgress {
+				close(download.done)
+			}
+		}
+	}
+}
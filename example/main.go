@@ -60,7 +60,7 @@ func main() {
 	}
 	defer dfr()
 
-	err = session.Frame.Navigate("https://zoid.ecwid.com")
+	err = session.Frame.NavigateAndWait("https://zoid.ecwid.com", control.LifecycleLoad)
 	if err != nil {
 		panic(err)
 	}
@@ -82,11 +82,7 @@ func main() {
 
 	log.Println(values, err)
 
-	err = retry.FuncPanic(retrier, func() {
-		node := session.Frame.MustQuery(`.pager__count-pages`)
-		node.MustGetBoundingClientRect()
-		node.MustClick()
-	})
+	err = session.Frame.Locator(`.pager__count-pages`).Click()
 	log.Println(err)
 
 	p := session.Frame.Evaluate(`new Promise((a,b) => a('ok'))`, false).MustGetValue().(control.RemoteObject)
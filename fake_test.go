@@ -0,0 +1,111 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ecwid/control/cdp"
+	"github.com/ecwid/control/protocol/runtime"
+	"github.com/ecwid/control/protocol/target"
+)
+
+// fakeConn answers requests of the transport with the handler, methods without answer get the empty result
+type fakeConn struct {
+	handler  func(method string, params json.RawMessage) (any, error)
+	messages chan []byte
+	done     chan struct{}
+	once     sync.Once
+	mutex    sync.Mutex
+	methods  []string
+}
+
+func (c *fakeConn) WriteJSON(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var request struct {
+		ID     uint64          `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err = json.Unmarshal(b, &request); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	c.methods = append(c.methods, request.Method)
+	c.mutex.Unlock()
+	var response = map[string]any{"id": request.ID, "result": map[string]any{}}
+	if c.handler != nil {
+		result, err := c.handler(request.Method, request.Params)
+		switch {
+		case err != nil:
+			response = map[string]any{"id": request.ID, "error": cdp.Error{Code: -32000, Message: err.Error()}}
+		case result != nil:
+			response["result"] = result
+		}
+	}
+	b, err = json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	go func() {
+		select {
+		case c.messages <- b:
+		case <-c.done:
+		}
+	}()
+	return nil
+}
+
+func (c *fakeConn) ReadJSON(v any) error {
+	select {
+	case b := <-c.messages:
+		return json.Unmarshal(b, v)
+	case <-c.done:
+		return errors.New("connection closed")
+	}
+}
+
+func (c *fakeConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return nil
+}
+
+// calls returns the number of requests of the method
+func (c *fakeConn) calls(method string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var n int
+	for _, value := range c.methods {
+		if value == method {
+			n++
+		}
+	}
+	return n
+}
+
+// newFakeSession returns the session of the page with the main world context created
+func newFakeSession(t *testing.T, handler func(method string, params json.RawMessage) (any, error)) (*Session, *fakeConn) {
+	conn := &fakeConn{handler: handler, messages: make(chan []byte), done: make(chan struct{})}
+	transport := cdp.New(context.Background(), conn, nil)
+	session := newSession(transport.Context(), transport, target.TargetID("page"))
+	session.frames.contextCreated(session.Frame.id, MainWorld, executionContext{id: 1, uniqueID: "main"})
+	t.Cleanup(func() {
+		session.cancel(ErrTargetDetached)
+		_ = transport.Disconnect()
+	})
+	return session, conn
+}
+
+func documentObject() *runtime.RemoteObject {
+	return &runtime.RemoteObject{
+		Type:                "object",
+		Subtype:             "node",
+		ObjectId:            "document",
+		DeepSerializedValue: &runtime.DeepSerializedValue{Type: "node"},
+	}
+}
@@ -0,0 +1,143 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/ecwid/control/protocol/dom"
+	"github.com/ecwid/control/protocol/page"
+)
+
+const (
+	FileChooserSingle   = "selectSingle"
+	FileChooserMultiple = "selectMultiple"
+)
+
+var ErrFileChooserWithoutInput = errors.New("file chooser is not opened by file input")
+
+// FileChooser is the file dialog opened by the page, it's intercepted so the dialog is not shown
+type FileChooser struct {
+	Mode          string
+	frame         *Frame
+	backendNodeID dom.BackendNodeId
+}
+
+type fileChooserInterception struct {
+	mutex     sync.Mutex
+	expecting int
+}
+
+func (c FileChooser) IsMultiple() bool {
+	return c.Mode == FileChooserMultiple
+}
+
+// Input returns the file input the chooser is opened by
+func (c FileChooser) Input() (*Node, error) {
+	if c.backendNodeID == 0 {
+		return nil, ErrFileChooserWithoutInput
+	}
+	args := dom.ResolveNodeArgs{BackendNodeId: c.backendNodeID}
+	if context, err := c.frame.executionContext(MainWorld); err == nil {
+		args.ExecutionContextId = context.id
+	}
+	value, err := dom.ResolveNode(c.frame, args)
+	if err != nil {
+		return nil, err
+	}
+	return &Node{object: remoteObjectValue(value.Object.ObjectId), frame: c.frame}, nil
+}
+
+func (c FileChooser) MustInput() *Node {
+	value, err := c.Input()
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// SetFiles selects the files as if the user picked them, no files clear the selection
+func (c FileChooser) SetFiles(paths ...string) error {
+	if len(paths) > 1 && !c.IsMultiple() {
+		return fmt.Errorf("file chooser accepts a single file, %d given", len(paths))
+	}
+	if c.backendNodeID == 0 {
+		return ErrFileChooserWithoutInput
+	}
+	var files = make([]string, len(paths))
+	for n, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		files[n] = abs
+	}
+	return dom.SetFileInputFiles(c.frame, dom.SetFileInputFilesArgs{
+		BackendNodeId: c.backendNodeID,
+		Files:         files,
+	})
+}
+
+func (c FileChooser) MustSetFiles(paths ...string) {
+	panicIfError(c.SetFiles(paths...))
+}
+
+// ExpectFileChooser calls trigger and returns the file chooser it opened,
+// file dialogs are intercepted while any ExpectFileChooser is waiting.
+// Pickers of the File System Access API (showOpenFilePicker) have no file input,
+// the protocol can't select files for them, so SetFiles returns ErrFileChooserWithoutInput
+func (s *Session) ExpectFileChooser(trigger func() error) (*FileChooser, error) {
+	future := Subscribe(s, "Page.fileChooserOpened", func(page.FileChooserOpened) bool {
+		return true
+	})
+	defer future.Cancel()
+	if err := s.interceptFileChooser(1); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := s.interceptFileChooser(-1); err != nil && !s.IsDone() {
+			s.Log("can't stop file chooser interception", err)
+		}
+	}()
+	if err := trigger(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(s.context, s.timeout)
+	defer cancel()
+	opened, err := future.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &FileChooser{
+		Mode:          opened.Mode,
+		frame:         &Frame{session: s, id: opened.FrameId},
+		backendNodeID: opened.BackendNodeId,
+	}, nil
+}
+
+func (s *Session) MustExpectFileChooser(trigger func() error) *FileChooser {
+	value, err := s.ExpectFileChooser(trigger)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// interceptFileChooser enables interception for the first waiter and disables it after the last one
+func (s *Session) interceptFileChooser(delta int) error {
+	c := s.fileChoosers
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	before := c.expecting
+	c.expecting += delta
+	if (before == 0) == (c.expecting == 0) {
+		return nil
+	}
+	err := page.SetInterceptFileChooserDialog(s, page.SetInterceptFileChooserDialogArgs{Enabled: c.expecting > 0})
+	if err != nil && delta > 0 {
+		c.expecting = before
+	}
+	return err
+}
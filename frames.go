@@ -0,0 +1,377 @@
+package control
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/ecwid/control/protocol/common"
+	"github.com/ecwid/control/protocol/dom"
+	"github.com/ecwid/control/protocol/page"
+	"github.com/ecwid/control/protocol/runtime"
+	"github.com/ecwid/control/protocol/target"
+)
+
+type NoSuchFrameError string
+
+func (n NoSuchFrameError) Error() string {
+	return fmt.Sprintf("no such frame found: `%s`", string(n))
+}
+
+type executionContext struct {
+	id       runtime.ExecutionContextId
+	uniqueID string
+}
+
+type frameInfo struct {
+	id       common.FrameId
+	parentID common.FrameId
+	name     string
+	url      string
+	contexts map[World]executionContext
+}
+
+// frameRegistry is the page's frame tree maintained by Page domain events
+type frameRegistry struct {
+	mutex    sync.RWMutex
+	frames   map[common.FrameId]*frameInfo
+	creating map[worldKey]*worldCreation
+	// adopted are handles of nodes resolved in isolated worlds by the handle in the main world and the world's context
+	adopted map[adoptedKey]runtime.RemoteObjectId
+}
+
+type worldKey struct {
+	frameID common.FrameId
+	world   World
+}
+
+// worldCreation is Page.createIsolatedWorld in flight, concurrent lookups wait for it instead of creating another world.
+// Created is set when Runtime.executionContextCreated of the world is handled before the response
+type worldCreation struct {
+	done    chan struct{}
+	value   executionContext
+	err     error
+	created bool
+}
+
+type adoptedKey struct {
+	objectID  runtime.RemoteObjectId
+	contextID runtime.ExecutionContextId
+}
+
+func newFrameRegistry() *frameRegistry {
+	return &frameRegistry{
+		frames:   map[common.FrameId]*frameInfo{},
+		creating: map[worldKey]*worldCreation{},
+		adopted:  map[adoptedKey]runtime.RemoteObjectId{},
+	}
+}
+
+// frame returns the frame's entry, the caller must hold the lock
+func (r *frameRegistry) frame(id common.FrameId) *frameInfo {
+	info, ok := r.frames[id]
+	if !ok {
+		info = &frameInfo{id: id, contexts: map[World]executionContext{}}
+		r.frames[id] = info
+	}
+	return info
+}
+
+func (r *frameRegistry) load(tree *page.FrameTree) {
+	if tree == nil || tree.Frame == nil {
+		return
+	}
+	r.navigated(tree.Frame)
+	for _, child := range tree.ChildFrames {
+		r.load(child)
+	}
+}
+
+func (r *frameRegistry) attached(id, parentID common.FrameId) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.frame(id).parentID = parentID
+}
+
+func (r *frameRegistry) navigated(frame *page.Frame) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	info := r.frame(frame.Id)
+	info.parentID = frame.ParentId
+	info.name = frame.Name
+	info.url = frame.Url
+}
+
+func (r *frameRegistry) navigatedWithinDocument(id common.FrameId, url string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.frame(id).url = url
+}
+
+// detached removes the frame with its descendants,
+// the frame swapped to another process stays in the tree without execution context
+func (r *frameRegistry) detached(id common.FrameId, reason string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if reason == "swap" {
+		if info, ok := r.frames[id]; ok {
+			clear(info.contexts)
+		}
+		return
+	}
+	r.remove(id)
+}
+
+func (r *frameRegistry) remove(id common.FrameId) {
+	delete(r.frames, id)
+	for childID, info := range r.frames {
+		if info.parentID == id {
+			r.remove(childID)
+		}
+	}
+}
+
+func (r *frameRegistry) contextCreated(id common.FrameId, world World, context executionContext) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.frame(id).contexts[world] = context
+	if creation, ok := r.creating[worldKey{frameID: id, world: world}]; ok {
+		creation.created = true
+	}
+}
+
+func (r *frameRegistry) contextDestroyed(uniqueID string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, info := range r.frames {
+		for world, context := range info.contexts {
+			if context.uniqueID == uniqueID {
+				delete(info.contexts, world)
+				r.forgetAdopted(context.id)
+			}
+		}
+	}
+}
+
+// forgetAdopted drops handles of the destroyed context, the caller must hold the lock
+func (r *frameRegistry) forgetAdopted(contextID runtime.ExecutionContextId) {
+	for key := range r.adopted {
+		if key.contextID == contextID {
+			delete(r.adopted, key)
+		}
+	}
+}
+
+func (r *frameRegistry) adoptedNode(objectID runtime.RemoteObjectId, contextID runtime.ExecutionContextId) (runtime.RemoteObjectId, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	value, ok := r.adopted[adoptedKey{objectID: objectID, contextID: contextID}]
+	return value, ok
+}
+
+// forgetNode drops handles adopted for the node in all worlds and returns them to be released
+func (r *frameRegistry) forgetNode(objectID runtime.RemoteObjectId) []runtime.RemoteObjectId {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var value []runtime.RemoteObjectId
+	for key, adopted := range r.adopted {
+		if key.objectID == objectID {
+			value = append(value, adopted)
+			delete(r.adopted, key)
+		}
+	}
+	return value
+}
+
+func (r *frameRegistry) nodeAdopted(objectID runtime.RemoteObjectId, contextID runtime.ExecutionContextId, adopted runtime.RemoteObjectId) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.adopted[adoptedKey{objectID: objectID, contextID: contextID}] = adopted
+}
+
+// createWorld runs create once per frame and world at a time, concurrent callers get the same result
+func (r *frameRegistry) createWorld(id common.FrameId, world World, create func() (executionContext, error)) (executionContext, error) {
+	key := worldKey{frameID: id, world: world}
+	r.mutex.Lock()
+	if context, ok := r.frame(id).contexts[world]; ok {
+		r.mutex.Unlock()
+		return context, nil
+	}
+	creation, ok := r.creating[key]
+	if !ok {
+		creation = &worldCreation{done: make(chan struct{})}
+		r.creating[key] = creation
+	}
+	r.mutex.Unlock()
+	if ok {
+		<-creation.done
+		return creation.value, creation.err
+	}
+	creation.value, creation.err = create()
+	r.mutex.Lock()
+	delete(r.creating, key)
+	if !creation.created && creation.err == nil {
+		// Runtime.executionContextCreated is not handled yet, it replaces the context with the one having uniqueID.
+		// If the event is handled already, the context is known or destroyed and must not be restored
+		r.frame(id).contexts[world] = creation.value
+	}
+	r.mutex.Unlock()
+	close(creation.done)
+	return creation.value, creation.err
+}
+
+func (r *frameRegistry) contextsCleared() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, info := range r.frames {
+		clear(info.contexts)
+	}
+	clear(r.adopted)
+}
+
+func (r *frameRegistry) context(id common.FrameId, world World) (executionContext, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if info, ok := r.frames[id]; ok {
+		context, ok := info.contexts[world]
+		return context, ok
+	}
+	return executionContext{}, false
+}
+
+func (r *frameRegistry) frameByContext(id runtime.ExecutionContextId) (common.FrameId, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for frameID, info := range r.frames {
+		for _, context := range info.contexts {
+			if context.id == id {
+				return frameID, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (r *frameRegistry) get(id common.FrameId) (frameInfo, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if info, ok := r.frames[id]; ok {
+		value := *info
+		value.contexts = nil // guarded by the mutex
+		return value, true
+	}
+	return frameInfo{}, false
+}
+
+func (r *frameRegistry) children(id common.FrameId) []common.FrameId {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	var value []common.FrameId
+	for childID, info := range r.frames {
+		if info.parentID == id {
+			value = append(value, childID)
+		}
+	}
+	return value
+}
+
+func (f Frame) URL() string {
+	info, _ := f.session.frames.get(f.id)
+	return info.url
+}
+
+// Name returns the name attribute of the frame's owner element
+func (f Frame) Name() string {
+	info, _ := f.session.frames.get(f.id)
+	return info.name
+}
+
+// Children returns child frames, out-of-process ones are bound to the sessions of their targets
+func (f *Frame) Children() []*Frame {
+	var value []*Frame
+	for _, id := range f.session.frames.children(f.id) {
+		session := f.session
+		if child, ok := session.child(target.TargetID(id)); ok {
+			session = child
+		}
+		value = append(value, &Frame{
+			id:      id,
+			session: session,
+			parent:  f,
+		})
+	}
+	return value
+}
+
+// owner returns the iframe element of the frame in the parent frame
+func (f *Frame) owner() (*Node, error) {
+	if f.node != nil {
+		return f.node, nil
+	}
+	if f.parent == nil {
+		return nil, NoSuchFrameError(f.id)
+	}
+	value, err := dom.GetFrameOwner(f.parent, dom.GetFrameOwnerArgs{FrameId: f.id})
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := dom.ResolveNode(f.parent, dom.ResolveNodeArgs{BackendNodeId: value.BackendNodeId})
+	if err != nil {
+		return nil, err
+	}
+	f.node = &Node{
+		object:            remoteObjectValue(resolved.Object.ObjectId),
+		requestedSelector: resolved.Object.Description,
+		frame:             f.parent,
+	}
+	return f.node, nil
+}
+
+// Frames returns all frames of the page in depth-first order including out-of-process ones
+func (s *Session) Frames() []*Frame {
+	var (
+		value []*Frame
+		walk  func(*Frame)
+	)
+	walk = func(frame *Frame) {
+		value = append(value, frame)
+		for _, child := range frame.Children() {
+			walk(child)
+		}
+	}
+	walk(s.Frame)
+	return value
+}
+
+func (s *Session) findFrame(predicate func(*Frame) bool) (*Frame, bool) {
+	for _, frame := range s.Frames() {
+		if predicate(frame) {
+			return frame, true
+		}
+	}
+	return nil, false
+}
+
+// FrameByURL returns the first frame in depth-first order with url matching the pattern
+func (s *Session) FrameByURL(pattern *regexp.Regexp) Optional[*Frame] {
+	if frame, ok := s.findFrame(func(f *Frame) bool { return pattern.MatchString(f.URL()) }); ok {
+		return Optional[*Frame]{value: frame}
+	}
+	return Optional[*Frame]{err: NoSuchFrameError(pattern.String())}
+}
+
+func (s *Session) MustFrameByURL(pattern *regexp.Regexp) *Frame {
+	return s.FrameByURL(pattern).MustGetValue()
+}
+
+// FrameByName returns the first frame in depth-first order with the name
+func (s *Session) FrameByName(name string) Optional[*Frame] {
+	if frame, ok := s.findFrame(func(f *Frame) bool { return f.Name() == name }); ok {
+		return Optional[*Frame]{value: frame}
+	}
+	return Optional[*Frame]{err: NoSuchFrameError(name)}
+}
+
+func (s *Session) MustFrameByName(name string) *Frame {
+	return s.FrameByName(name).MustGetValue()
+}
@@ -0,0 +1,64 @@
+package control
+
+import (
+	"testing"
+
+	"github.com/ecwid/control/protocol/common"
+)
+
+func TestCreateWorldAfterContextDestroyed(t *testing.T) {
+	var (
+		registry = newFrameRegistry()
+		frameID  = common.FrameId("frame")
+		created  = executionContext{id: 2, uniqueID: "utility"}
+	)
+	_, err := registry.createWorld(frameID, UtilityWorld, func() (executionContext, error) {
+		// the events are handled before the response of Page.createIsolatedWorld
+		registry.contextCreated(frameID, UtilityWorld, created)
+		registry.contextDestroyed(created.uniqueID)
+		return executionContext{id: created.id}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := registry.context(frameID, UtilityWorld); ok {
+		t.Errorf("destroyed context %+v is restored", value)
+	}
+}
+
+func TestCreateWorldBeforeContextCreated(t *testing.T) {
+	var (
+		registry = newFrameRegistry()
+		frameID  = common.FrameId("frame")
+		created  = executionContext{id: 2, uniqueID: "utility"}
+	)
+	_, err := registry.createWorld(frameID, UtilityWorld, func() (executionContext, error) {
+		return executionContext{id: created.id}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := registry.context(frameID, UtilityWorld); !ok {
+		t.Fatal("context is not known before the event")
+	}
+	registry.contextCreated(frameID, UtilityWorld, created)
+	registry.contextDestroyed(created.uniqueID)
+	if value, ok := registry.context(frameID, UtilityWorld); ok {
+		t.Errorf("destroyed context %+v is not evicted", value)
+	}
+}
+
+func TestForgetNode(t *testing.T) {
+	registry := newFrameRegistry()
+	registry.nodeAdopted("node", 2, "utility-node")
+	registry.nodeAdopted("other", 2, "utility-other")
+	if value := registry.forgetNode("node"); len(value) != 1 || value[0] != "utility-node" {
+		t.Errorf("forgotten handles %v, expected [utility-node]", value)
+	}
+	if _, ok := registry.adoptedNode("node", 2); ok {
+		t.Error("handle of the released node is kept")
+	}
+	if _, ok := registry.adoptedNode("other", 2); !ok {
+		t.Error("handle of another node is dropped")
+	}
+}
@@ -0,0 +1,564 @@
+package control
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ecwid/control/cdp"
+	"github.com/ecwid/control/protocol/fetch"
+	"github.com/ecwid/control/protocol/network"
+)
+
+// HAR 1.2 http://www.softwareishard.com/blog/har-12-spec/
+type HAR struct {
+	Log *HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator *HARCreator `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HAREntry struct {
+	StartedDateTime string       `json:"startedDateTime"`
+	Time            float64      `json:"time"`
+	Request         *HARRequest  `json:"request"`
+	Response        *HARResponse `json:"response"`
+	Cache           struct{}     `json:"cache"`
+	Timings         *HARTimings  `json:"timings"`
+	ServerIPAddress string       `json:"serverIPAddress,omitempty"`
+	Comment         string       `json:"comment,omitempty"`
+}
+
+type HARRequest struct {
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []*HARNameValue `json:"cookies"`
+	Headers     []*HARNameValue `json:"headers"`
+	QueryString []*HARNameValue `json:"queryString"`
+	PostData    *HARPostData    `json:"postData,omitempty"`
+	HeadersSize int             `json:"headersSize"`
+	BodySize    int             `json:"bodySize"`
+}
+
+type HARResponse struct {
+	Status      int             `json:"status"`
+	StatusText  string          `json:"statusText"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []*HARNameValue `json:"cookies"`
+	Headers     []*HARNameValue `json:"headers"`
+	Content     *HARContent     `json:"content"`
+	RedirectURL string          `json:"redirectURL"`
+	HeadersSize int             `json:"headersSize"`
+	BodySize    int             `json:"bodySize"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARPostData struct {
+	MimeType string          `json:"mimeType"`
+	Params   []*HARNameValue `json:"params"`
+	Text     string          `json:"text"`
+}
+
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+func LoadHAR(filename string) (*HAR, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var value = &HAR{}
+	if err = json.Unmarshal(b, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (h *HAR) Save(filename string) error {
+	b, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b, 0o644)
+}
+
+var (
+	ErrHARAlreadyStarted = errors.New("har recording is already started")
+	ErrHARNotStarted     = errors.New("har recording is not started")
+)
+
+const harTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+type harPending struct {
+	entry     *HAREntry
+	timestamp network.MonotonicTime
+	timing    *network.ResourceTiming
+}
+
+type harRecorder struct {
+	mutex   sync.Mutex
+	entries []*HAREntry
+	pending map[network.RequestId]*harPending
+	bodies  sync.WaitGroup
+	cancel  func()
+	done    chan struct{}
+}
+
+// StartHAR starts recording of all the network requests of the session
+func (s *Session) StartHAR() error {
+	s.harMutex.Lock()
+	defer s.harMutex.Unlock()
+	if s.har != nil {
+		return ErrHARAlreadyStarted
+	}
+	channel, cancel := s.Subscribe()
+	recorder := &harRecorder{
+		pending: map[network.RequestId]*harPending{},
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(recorder.done)
+		for message := range channel {
+			if err := recorder.handle(s, message); err != nil {
+				s.Log("har recorder", err)
+			}
+		}
+	}()
+	s.har = recorder
+	return nil
+}
+
+func (s *Session) MustStartHAR() {
+	panicIfError(s.StartHAR())
+}
+
+// StopHAR stops recording and returns requests recorded since StartHAR
+func (s *Session) StopHAR() (*HAR, error) {
+	s.harMutex.Lock()
+	recorder := s.har
+	s.har = nil
+	s.harMutex.Unlock()
+	if recorder == nil {
+		return nil, ErrHARNotStarted
+	}
+	recorder.cancel()
+	<-recorder.done
+	recorder.bodies.Wait()
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	// requests without response yet have no timings and content, they are dropped
+	var entries = make([]*HAREntry, 0, len(recorder.entries))
+	for _, entry := range recorder.entries {
+		if !recorder.isPending(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return &HAR{
+		Log: &HARLog{
+			Version: "1.2",
+			Creator: &HARCreator{Name: "control"},
+			Entries: entries,
+		},
+	}, nil
+}
+
+func (s *Session) MustStopHAR() *HAR {
+	value, err := s.StopHAR()
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// isPending reports whether the entry is not finished, the caller must hold the lock
+func (r *harRecorder) isPending(entry *HAREntry) bool {
+	for _, p := range r.pending {
+		if p.entry == entry {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *harRecorder) handle(s *Session, message cdp.Message) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch message.Method {
+
+	case "Network.requestWillBeSent":
+		var event network.RequestWillBeSent
+		if err := json.Unmarshal(message.Params, &event); err != nil {
+			return err
+		}
+		if p, ok := r.pending[event.RequestId]; ok && event.RedirectResponse != nil {
+			p.response(event.RedirectResponse)
+			p.entry.Response.RedirectURL = event.Request.Url
+			p.finish(event.Timestamp)
+			delete(r.pending, event.RequestId)
+		}
+		p := &harPending{
+			entry:     newHAREntry(event),
+			timestamp: event.Timestamp,
+		}
+		r.pending[event.RequestId] = p
+		r.entries = append(r.entries, p.entry)
+		if event.Request.HasPostData && event.Request.PostData == "" {
+			r.postData(s, event.RequestId, p.entry.Request)
+		}
+
+	case "Network.responseReceived":
+		var event network.ResponseReceived
+		if err := json.Unmarshal(message.Params, &event); err != nil {
+			return err
+		}
+		if p, ok := r.pending[event.RequestId]; ok {
+			p.response(event.Response)
+		}
+
+	case "Network.loadingFinished":
+		var event network.LoadingFinished
+		if err := json.Unmarshal(message.Params, &event); err != nil {
+			return err
+		}
+		p, ok := r.pending[event.RequestId]
+		if !ok {
+			return nil
+		}
+		delete(r.pending, event.RequestId)
+		p.entry.Response.BodySize = int(event.EncodedDataLength)
+		p.finish(event.Timestamp)
+		r.bodies.Add(1)
+		go func() {
+			defer r.bodies.Done()
+			body, err := network.GetResponseBody(s, network.GetResponseBodyArgs{RequestId: event.RequestId})
+			if err != nil {
+				return // no body for redirects, preflight and some cached responses
+			}
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			content := p.entry.Response.Content
+			content.Text = body.Body
+			content.Size = len(body.Body)
+			if body.Base64Encoded {
+				content.Encoding = "base64"
+				content.Size = base64.StdEncoding.DecodedLen(len(body.Body))
+			}
+		}()
+
+	case "Network.loadingFailed":
+		var event network.LoadingFailed
+		if err := json.Unmarshal(message.Params, &event); err != nil {
+			return err
+		}
+		if p, ok := r.pending[event.RequestId]; ok {
+			delete(r.pending, event.RequestId)
+			p.entry.Comment = event.ErrorText
+			p.finish(event.Timestamp)
+		}
+	}
+	return nil
+}
+
+// postData fetches the request body which is larger than MaxPostDataSize, Chrome doesn't inline it in the event
+func (r *harRecorder) postData(s *Session, id network.RequestId, request *HARRequest) {
+	r.bodies.Add(1)
+	go func() {
+		defer r.bodies.Done()
+		value, err := network.GetRequestPostData(s, network.GetRequestPostDataArgs{RequestId: id})
+		if err != nil {
+			return // the body is gone, e.g. the request is already redirected
+		}
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		request.BodySize = len(value.PostData)
+		request.PostData.Text = truncatePostData(value.PostData)
+	}()
+}
+
+func truncatePostData(text string) string {
+	if len(text) > MaxPostDataSize {
+		return text[:MaxPostDataSize]
+	}
+	return text
+}
+
+func newHAREntry(event network.RequestWillBeSent) *HAREntry {
+	sec := float64(event.WallTime)
+	started := time.Unix(0, int64(sec*float64(time.Second)))
+	request := &HARRequest{
+		Method:      event.Request.Method,
+		URL:         event.Request.Url,
+		Cookies:     []*HARNameValue{},
+		Headers:     harHeaders(event.Request.Headers),
+		QueryString: []*HARNameValue{},
+		HeadersSize: -1,
+	}
+	if u, err := url.Parse(event.Request.Url); err == nil {
+		for name, values := range u.Query() {
+			for _, value := range values {
+				request.QueryString = append(request.QueryString, &HARNameValue{Name: name, Value: value})
+			}
+		}
+	}
+	if event.Request.HasPostData {
+		// the body missing in the event is fetched by harRecorder.postData
+		request.PostData = &HARPostData{
+			MimeType: headerValue(event.Request.Headers, "Content-Type"),
+			Params:   []*HARNameValue{},
+			Text:     truncatePostData(event.Request.PostData),
+		}
+		request.BodySize = len(event.Request.PostData)
+	}
+	return &HAREntry{
+		StartedDateTime: started.Format(harTimeLayout),
+		Request:         request,
+		Response: &HARResponse{
+			Cookies:     []*HARNameValue{},
+			Headers:     []*HARNameValue{},
+			Content:     &HARContent{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Timings: &HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1},
+	}
+}
+
+func (p *harPending) response(response *network.Response) {
+	var headers network.Headers
+	if response.Headers != nil {
+		headers = *response.Headers
+	}
+	p.entry.Response.Status = response.Status
+	p.entry.Response.StatusText = response.StatusText
+	p.entry.Response.HTTPVersion = harHTTPVersion(response.Protocol)
+	p.entry.Response.Headers = harHeaders(headers)
+	p.entry.Response.Content.MimeType = response.MimeType
+	p.entry.Request.HTTPVersion = p.entry.Response.HTTPVersion
+	p.entry.ServerIPAddress = response.RemoteIPAddress
+	p.timing = response.Timing
+}
+
+// finish calculates timings of the entry in the same way as Chrome DevTools does on HAR export
+func (p *harPending) finish(timestamp network.MonotonicTime) {
+	var (
+		t     = p.entry.Timings
+		total = (float64(timestamp) - float64(p.timestamp)) * 1000
+	)
+	if p.timing == nil {
+		t.Send, t.Wait, t.Receive = 0, 0, total
+		p.entry.Time = total
+		return
+	}
+	timing := p.timing
+	positive := func(values ...float64) float64 {
+		for _, value := range values {
+			if value >= 0 {
+				return value
+			}
+		}
+		return -1
+	}
+	t.Blocked = positive(timing.DnsStart, timing.ConnectStart, timing.SendStart)
+	if timing.DnsStart >= 0 {
+		t.DNS = timing.DnsEnd - timing.DnsStart
+	}
+	if timing.ConnectStart >= 0 {
+		t.Connect = timing.ConnectEnd - timing.ConnectStart
+	}
+	if timing.SslStart >= 0 {
+		t.SSL = timing.SslEnd - timing.SslStart
+	}
+	t.Send = timing.SendEnd - timing.SendStart
+	t.Wait = timing.ReceiveHeadersEnd - timing.SendEnd
+	t.Receive = (float64(timestamp)-timing.RequestTime)*1000 - timing.ReceiveHeadersEnd
+	if t.Receive < 0 {
+		t.Receive = 0
+	}
+	p.entry.Time = t.Send + t.Wait + t.Receive
+	for _, value := range []float64{t.Blocked, t.DNS, t.Connect} {
+		if value > 0 {
+			p.entry.Time += value
+		}
+	}
+}
+
+func harHeaders(headers network.Headers) []*HARNameValue {
+	var value = []*HARNameValue{}
+	for name, v := range headersToMap(headers) {
+		// multiple values of the same header are joined by newline
+		for _, line := range strings.Split(v, "\n") {
+			value = append(value, &HARNameValue{Name: name, Value: line})
+		}
+	}
+	return value
+}
+
+func headerValue(headers network.Headers, name string) string {
+	for key, value := range headersToMap(headers) {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+func harHTTPVersion(protocol string) string {
+	switch protocol {
+	case "h2":
+		return "HTTP/2.0"
+	case "h3", "h3-29", "quic":
+		return "HTTP/3.0"
+	default:
+		return strings.ToUpper(protocol)
+	}
+}
+
+// HARReplay serves recorded responses from HAR instead of network
+type HARReplay struct {
+	// NotFound is called for requests not found in the HAR, by default they are aborted
+	NotFound func(*InterceptedRequest)
+	mutex    sync.Mutex
+	entries  map[string][]*HAREntry
+	served   map[*HAREntry]bool
+}
+
+func NewHARReplay(har *HAR) *HARReplay {
+	replay := &HARReplay{
+		entries: map[string][]*HAREntry{},
+		served:  map[*HAREntry]bool{},
+	}
+	for _, entry := range har.Log.Entries {
+		if entry.Response == nil || entry.Response.Status == 0 {
+			continue // failed requests
+		}
+		key := harKey(entry.Request.Method, entry.Request.URL)
+		replay.entries[key] = append(replay.entries[key], entry)
+	}
+	return replay
+}
+
+func harKey(method, url string) string {
+	return method + " " + url
+}
+
+// lookup returns recorded entries of the same request in the recorded order, the last one is served repeatedly.
+// Entries with the same post data are preferred, served ones are tracked per entry so filtering doesn't skip them
+func (h *HARReplay) lookup(request *InterceptedRequest) *HAREntry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	key := harKey(request.Method(), request.Url())
+	entries := h.entries[key]
+	if len(entries) == 0 {
+		return nil
+	}
+	var candidates = entries
+	if postData := request.PostData(); postData != "" {
+		candidates = nil
+		for _, entry := range entries {
+			if entry.Request.PostData != nil && entry.Request.PostData.Text == postData {
+				candidates = append(candidates, entry)
+			}
+		}
+		if len(candidates) == 0 {
+			candidates = entries
+		}
+	}
+	for _, entry := range candidates {
+		if !h.served[entry] {
+			h.served[entry] = true
+			return entry
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+func (h *HARReplay) handle(request *InterceptedRequest) {
+	entry := h.lookup(request)
+	if entry == nil {
+		if h.NotFound != nil {
+			h.NotFound(request)
+			return
+		}
+		_ = request.Abort(ErrorReasonInternetDisconnected)
+		return
+	}
+	var body []byte
+	if content := entry.Response.Content; content != nil {
+		body = []byte(content.Text)
+		if content.Encoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(content.Text)
+			if err != nil {
+				_ = request.Abort(ErrorReasonFailed)
+				return
+			}
+			body = decoded
+		}
+	}
+	// repeated headers like Set-Cookie are sent as separate entries
+	var headers []*fetch.HeaderEntry
+	for _, header := range entry.Response.Headers {
+		switch http.CanonicalHeaderKey(header.Name) {
+		case "Content-Encoding", "Content-Length", "Transfer-Encoding":
+			// recorded body is already decoded
+			continue
+		case "Location":
+			if entry.Response.RedirectURL != "" {
+				continue
+			}
+		}
+		headers = append(headers, &fetch.HeaderEntry{Name: header.Name, Value: header.Value})
+	}
+	if entry.Response.RedirectURL != "" {
+		headers = append(headers, &fetch.HeaderEntry{Name: "Location", Value: entry.Response.RedirectURL})
+	}
+	_ = request.fulfill(entry.Response.Status, headers, body)
+}
+
+// Route serves requests matching the wildcard pattern from the HAR
+func (h *HARReplay) Route(s *Session, pattern string) (unroute func() error, err error) {
+	return s.Route(pattern, h.handle)
+}
+
+func (h *HARReplay) MustRoute(s *Session, pattern string) (unroute func() error) {
+	unroute, err := h.Route(s, pattern)
+	if err != nil {
+		panic(err)
+	}
+	return unroute
+}
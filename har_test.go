@@ -0,0 +1,45 @@
+package control
+
+import (
+	"testing"
+
+	"github.com/ecwid/control/protocol/network"
+)
+
+func TestHARReplayLookup(t *testing.T) {
+	entry := func(postData, body string) *HAREntry {
+		value := &HAREntry{
+			Request:  &HARRequest{Method: "POST", URL: "https://example.com/api"},
+			Response: &HARResponse{Status: 200, Content: &HARContent{Text: body}},
+		}
+		if postData != "" {
+			value.Request.PostData = &HARPostData{Text: postData}
+		}
+		return value
+	}
+	replay := NewHARReplay(&HAR{Log: &HARLog{Entries: []*HAREntry{
+		entry("a", "a1"),
+		entry("b", "b1"),
+		entry("a", "a2"),
+	}}})
+	request := func(postData string) *InterceptedRequest {
+		return &InterceptedRequest{Request: &network.Request{Method: "POST", Url: "https://example.com/api", PostData: postData}}
+	}
+	tests := []struct {
+		postData string
+		expected string
+	}{
+		{postData: "b", expected: "b1"},
+		{postData: "a", expected: "a1"},
+		{postData: "a", expected: "a2"},
+		{postData: "a", expected: "a2"},
+		{postData: "b", expected: "b1"},
+		{postData: "c", expected: "a2"},
+	}
+	for n, test := range tests {
+		value := replay.lookup(request(test.postData))
+		if value == nil || value.Response.Content.Text != test.expected {
+			t.Fatalf("request %d with `%s` served %+v, expected %s", n, test.postData, value, test.expected)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package control
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ecwid/control/protocol/page"
+)
+
+var ErrInitScriptNotFound = errors.New("init script not found")
+
+type InitScriptOptions struct {
+	// World is the isolated world the script runs in, it's created in every new document. MainWorld by default
+	World                 World
+	IncludeCommandLineAPI bool
+}
+
+// InitScriptID identifies the script in the session and in its auto-attached child sessions
+type InitScriptID int64
+
+var initScriptSeq atomic.Int64
+
+type initScript struct {
+	source     string
+	options    InitScriptOptions
+	identifier page.ScriptIdentifier
+}
+
+type initScriptTable struct {
+	mutex   sync.Mutex
+	scripts map[InitScriptID]*initScript
+	order   []InitScriptID
+}
+
+// AddInitScript evaluates the source in every frame before page scripts on each navigation,
+// the script is added to out-of-process iframes as well
+func (s *Session) AddInitScript(source string, options InitScriptOptions) (InitScriptID, error) {
+	id := InitScriptID(initScriptSeq.Add(1))
+	if err := s.addInitScript(id, source, options); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Session) MustAddInitScript(source string, options InitScriptOptions) InitScriptID {
+	value, err := s.AddInitScript(source, options)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+func (s *Session) addInitScript(id InitScriptID, source string, options InitScriptOptions) error {
+	s.initScripts.mutex.Lock()
+	_, exists := s.initScripts.scripts[id]
+	s.initScripts.mutex.Unlock()
+	if exists {
+		return nil // already copied from the parent on attach
+	}
+	value, err := page.AddScriptToEvaluateOnNewDocument(s, page.AddScriptToEvaluateOnNewDocumentArgs{
+		Source:                source,
+		WorldName:             string(options.World),
+		IncludeCommandLineAPI: options.IncludeCommandLineAPI,
+	})
+	if err != nil {
+		return err
+	}
+	s.initScripts.mutex.Lock()
+	s.initScripts.scripts[id] = &initScript{source: source, options: options, identifier: value.Identifier}
+	s.initScripts.order = append(s.initScripts.order, id)
+	s.initScripts.mutex.Unlock()
+
+	for _, child := range s.Children() {
+		if err = child.addInitScript(id, source, options); err != nil && !child.IsDone() {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveInitScript removes the script from the session and its child sessions, current documents are not affected
+func (s *Session) RemoveInitScript(id InitScriptID) error {
+	s.initScripts.mutex.Lock()
+	script, ok := s.initScripts.scripts[id]
+	if ok {
+		delete(s.initScripts.scripts, id)
+		for n, value := range s.initScripts.order {
+			if value == id {
+				s.initScripts.order = append(s.initScripts.order[:n], s.initScripts.order[n+1:]...)
+				break
+			}
+		}
+	}
+	s.initScripts.mutex.Unlock()
+	if !ok {
+		return ErrInitScriptNotFound
+	}
+	err := page.RemoveScriptToEvaluateOnNewDocument(s, page.RemoveScriptToEvaluateOnNewDocumentArgs{Identifier: script.identifier})
+	if err != nil {
+		return err
+	}
+	for _, child := range s.Children() {
+		if err = child.RemoveInitScript(id); err != nil && err != ErrInitScriptNotFound && !child.IsDone() {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Session) MustRemoveInitScript(id InitScriptID) {
+	panicIfError(s.RemoveInitScript(id))
+}
+
+// initScriptsTo adds scripts of the session to the auto-attached child session in the order they were added
+func (s *Session) initScriptsTo(child *Session) error {
+	type entry struct {
+		id     InitScriptID
+		script initScript
+	}
+	s.initScripts.mutex.Lock()
+	var entries = make([]entry, 0, len(s.initScripts.order))
+	for _, id := range s.initScripts.order {
+		entries = append(entries, entry{id: id, script: *s.initScripts.scripts[id]})
+	}
+	s.initScripts.mutex.Unlock()
+	for _, e := range entries {
+		if err := child.addInitScript(e.id, e.script.source, e.script.options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// LocatorPollingInterval is a delay between attempts to resolve a locator and perform an action on it
+var LocatorPollingInterval = 100 * time.Millisecond
+
+// Locator is a lazy reference to a node of the frame described by a chain of css selectors.
+// Unlike Node it is never stale: the node is resolved again on every action.
+type Locator struct {
+	frame    *Frame
+	parent   *Locator
+	selector string
+}
+
+func (f *Frame) Locator(cssSelector string) *Locator {
+	return &Locator{
+		frame:    f,
+		selector: cssSelector,
+	}
+}
+
+func (l *Locator) Locator(cssSelector string) *Locator {
+	return &Locator{
+		frame:    l.frame,
+		parent:   l,
+		selector: cssSelector,
+	}
+}
+
+func (l *Locator) OwnerFrame() *Frame {
+	return l.frame
+}
+
+func (l *Locator) String() string {
+	if l.parent == nil {
+		return l.selector
+	}
+	return l.parent.String() + " >> " + l.selector
+}
+
+func (l *Locator) resolve() (*Node, error) {
+	if l.parent == nil {
+		return l.frame.Query(l.selector).Unwrap()
+	}
+	parent, err := l.parent.resolve()
+	if err != nil {
+		return nil, err
+	}
+	node, err := parent.Query(l.selector).Unwrap()
+	parent.release()
+	if err != nil {
+		return nil, err
+	}
+	node.requestedSelector = l.String()
+	return node, nil
+}
+
+// release drops the remote object of the node resolved by the locator, the node is not used anymore
+func (e *Node) release() {
+	if err := e.ReleaseObject(); err != nil && !e.frame.session.IsDone() {
+		e.frame.session.Log("can't release node", err, "selector", e.requestedSelector)
+	}
+}
+
+// wait resolves a fresh node until it passes the check or the session timeout is reached,
+// nodes failed the check are released, the passed one is owned by the caller
+func (l *Locator) wait(check func(*Node) error) (*Node, error) {
+	ctx, cancel := context.WithTimeout(l.frame.session.context, l.frame.session.timeout)
+	defer cancel()
+	for {
+		node, err := l.resolve()
+		if err == nil {
+			if err = check(node); err == nil {
+				return node, nil
+			}
+			node.release()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(LocatorPollingInterval):
+		}
+	}
+}
+
+// do runs the action once on the node passed the check, the action is not repeated as it may be partially done
+func (l *Locator) do(check, action func(*Node) error) error {
+	node, err := l.wait(check)
+	if err != nil {
+		return err
+	}
+	defer node.release()
+	return action(node)
+}
+
+func (l *Locator) waitActionable(action func(*Node) error) error {
+	return l.do(func(node *Node) error {
+		return node.checkActionable()
+	}, action)
+}
+
+func (e Node) checkActionable() error {
+	if !e.IsConnected() {
+		return NodeDetachedError(e.requestedSelector)
+	}
+	if _, err := e.clickablePoint(); err != nil {
+		return err
+	}
+	enabled, err := e.IsEnabled().Unwrap()
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return NodeDisabledError(e.requestedSelector)
+	}
+	return nil
+}
+
+func (l *Locator) Node() Optional[*Node] {
+	return optional[*Node](l.wait(func(*Node) error { return nil }))
+}
+
+func (l *Locator) MustNode() *Node {
+	return l.Node().MustGetValue()
+}
+
+// All returns nodes matching the locator at the moment, the list is empty if there are none
+func (l *Locator) All() Optional[NodeList] {
+	var value Optional[NodeList]
+	if l.parent == nil {
+		value = l.frame.QueryAll(l.selector)
+	} else if parent, err := l.parent.resolve(); err == nil {
+		value = parent.QueryAll(l.selector)
+		parent.release()
+	} else {
+		value = Optional[NodeList]{err: err}
+	}
+	var noSuchSelector NoSuchSelectorError
+	if errors.As(value.err, &noSuchSelector) {
+		return Optional[NodeList]{value: NodeList{}}
+	}
+	return value
+}
+
+func (l *Locator) MustAll() NodeList {
+	return l.All().MustGetValue()
+}
+
+func (l *Locator) WaitVisible() error {
+	return l.do(func(node *Node) error {
+		visible, err := node.CheckVisibility().Unwrap()
+		if err != nil {
+			return err
+		}
+		if !visible {
+			return NodeInvisibleError(node.requestedSelector)
+		}
+		return nil
+	}, func(*Node) error { return nil })
+}
+
+func (l *Locator) MustWaitVisible() {
+	panicIfError(l.WaitVisible())
+}
+
+func (l *Locator) Click() error {
+	return l.waitActionable(func(node *Node) error {
+		return node.Click()
+	})
+}
+
+func (l *Locator) MustClick() {
+	panicIfError(l.Click())
+}
+
+func (l *Locator) Hover() error {
+	return l.waitActionable(func(node *Node) error {
+		return node.Hover()
+	})
+}
+
+func (l *Locator) MustHover() {
+	panicIfError(l.Hover())
+}
+
+func (l *Locator) SetText(value string) error {
+	return l.waitActionable(func(node *Node) error {
+		return node.SetText(value)
+	})
+}
+
+func (l *Locator) MustSetText(value string) {
+	panicIfError(l.SetText(value))
+}
+
+func (l *Locator) InsertText(value string) error {
+	return l.waitActionable(func(node *Node) error {
+		return node.InsertText(value)
+	})
+}
+
+func (l *Locator) MustInsertText(value string) {
+	panicIfError(l.InsertText(value))
+}
+
+func (l *Locator) SelectByValues(values ...string) error {
+	return l.waitActionable(func(node *Node) error {
+		return node.SelectByValues(values...)
+	})
+}
+
+func (l *Locator) MustSelectByValues(values ...string) {
+	panicIfError(l.SelectByValues(values...))
+}
+
+func (l *Locator) SetCheckbox(check bool) error {
+	return l.waitActionable(func(node *Node) error {
+		return node.SetCheckbox(check)
+	})
+}
+
+func (l *Locator) MustSetCheckbox(check bool) {
+	panicIfError(l.SetCheckbox(check))
+}
+
+func (l *Locator) GetText() Optional[string] {
+	return locatorValue(l, func(node *Node) Optional[string] {
+		return node.GetText()
+	})
+}
+
+func (l *Locator) MustGetText() string {
+	return l.GetText().MustGetValue()
+}
+
+func (l *Locator) GetAttribute(attr string) Optional[string] {
+	return locatorValue(l, func(node *Node) Optional[string] {
+		return node.GetAttribute(attr)
+	})
+}
+
+func (l *Locator) MustGetAttribute(attr string) string {
+	return l.GetAttribute(attr).MustGetValue()
+}
+
+func (l *Locator) HasClass(class string) Optional[bool] {
+	return locatorValue(l, func(node *Node) Optional[bool] {
+		return node.HasClass(class)
+	})
+}
+
+func (l *Locator) MustHasClass(class string) bool {
+	return l.HasClass(class).MustGetValue()
+}
+
+func (l *Locator) IsChecked() Optional[bool] {
+	return locatorValue(l, func(node *Node) Optional[bool] {
+		return node.IsChecked()
+	})
+}
+
+func (l *Locator) MustIsChecked() bool {
+	return l.IsChecked().MustGetValue()
+}
+
+// locatorValue repeats the getter until it succeeds, reading the value has no side effects
+func locatorValue[T any](l *Locator, getter func(*Node) Optional[T]) Optional[T] {
+	var value T
+	node, err := l.wait(func(node *Node) (err error) {
+		value, err = getter(node).Unwrap()
+		return err
+	})
+	if err != nil {
+		return Optional[T]{err: err}
+	}
+	node.release()
+	return Optional[T]{value: value}
+}
@@ -0,0 +1,92 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ecwid/control/protocol/runtime"
+)
+
+// queryHandler answers the document, querySelector with a node and querySelectorAll with the empty list
+func queryHandler(method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "Runtime.evaluate":
+		return runtime.EvaluateVal{Result: documentObject()}, nil
+	case "Runtime.callFunctionOn":
+		var args runtime.CallFunctionOnArgs
+		if err := json.Unmarshal(params, &args); err != nil {
+			return nil, err
+		}
+		if strings.Contains(args.FunctionDeclaration, "querySelectorAll") {
+			return runtime.CallFunctionOnVal{Result: &runtime.RemoteObject{
+				Type:                "object",
+				Subtype:             "nodelist",
+				Description:         "NodeList(0)",
+				ObjectId:            "list",
+				DeepSerializedValue: &runtime.DeepSerializedValue{Type: "nodelist"},
+			}}, nil
+		}
+		return runtime.CallFunctionOnVal{Result: &runtime.RemoteObject{
+			Type:                "object",
+			Subtype:             "node",
+			ObjectId:            "node",
+			DeepSerializedValue: &runtime.DeepSerializedValue{Type: "node"},
+		}}, nil
+	}
+	return nil, nil
+}
+
+func TestLocatorAllWithoutMatches(t *testing.T) {
+	session, _ := newFakeSession(t, queryHandler)
+	tests := []struct {
+		name    string
+		locator *Locator
+	}{
+		{name: "frame", locator: session.Frame.Locator(".item")},
+		{name: "parent", locator: session.Frame.Locator(".list").Locator(".item")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nodes, err := test.locator.All().Unwrap()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nodes == nil || len(nodes) != 0 {
+				t.Errorf("expected empty list, got %v", nodes)
+			}
+		})
+	}
+}
+
+func TestLocatorActionRunsOnce(t *testing.T) {
+	defer func(value time.Duration) { LocatorPollingInterval = value }(LocatorPollingInterval)
+	LocatorPollingInterval = time.Millisecond
+	session, conn := newFakeSession(t, queryHandler)
+	var (
+		checks    int
+		actions   int
+		errAction = errors.New("action failed")
+	)
+	err := session.Frame.Locator(".item").do(func(*Node) error {
+		if checks++; checks < 3 {
+			return errors.New("not ready")
+		}
+		return nil
+	}, func(*Node) error {
+		actions++
+		return errAction
+	})
+	if !errors.Is(err, errAction) {
+		t.Fatalf("error %v, expected %v", err, errAction)
+	}
+	if checks != 3 || actions != 1 {
+		t.Errorf("%d checks and %d actions, expected 3 checks and 1 action", checks, actions)
+	}
+	// the document and the node of every attempt
+	if released := conn.calls("Runtime.releaseObject"); released != 2*checks {
+		t.Errorf("%d objects released, expected %d", released, 2*checks)
+	}
+}
@@ -6,77 +6,147 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/ecwid/control/cdp"
 	"github.com/ecwid/control/chrome"
 	"github.com/ecwid/control/protocol/target"
 )
 
+// ShutdownTimeout is a time given to the browser to exit gracefully before it's killed
+var ShutdownTimeout = 10 * time.Second
+
 func Take(args ...string) (session *Session, cancel func() error, err error) {
 	return TakeWithContext(context.TODO(), nil, args...)
 }
 
-func hasProfile(args ...string) bool {
-	for _, a := range args {
-		a = strings.TrimSpace(a)
-		if strings.HasPrefix(a, "--profile-directory") || strings.HasPrefix(a, "--user-data-dir") {
-			return true
-		}
-	}
-	return false
-}
-
 func TakeWithContext(ctx context.Context, logger *slog.Logger, args ...string) (session *Session, cancel func() error, err error) {
-	var userDataDir string
+	return TakeWithOptions(ctx, logger, chrome.Options{Flags: args})
+}
 
-	if !hasProfile(args...) {
-		// If there is no profile or user-data-dir in the startup arguments, then user-data-dir must be set
-		userDataDir, err = os.MkdirTemp("", "chrome-control-*")
-		if err != nil {
-			return nil, nil, errors.Join(err, errors.New("can't create temporary user data dir"))
-		}
-		args = append(args, "--user-data-dir="+userDataDir)
+func TakeWithOptions(ctx context.Context, logger *slog.Logger, options chrome.Options) (session *Session, cancel func() error, err error) {
+	browser, transport, err := launch(ctx, logger, options)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	browser, err := chrome.Launch(ctx, args...)
+	tab, err := target.CreateTarget(transport, target.CreateTargetArgs{Url: Blank})
 	if err != nil {
-		return nil, nil, errors.Join(err, errors.New("chrome launch failed"))
+		return nil, nil, errors.Join(err, errors.New("failed to open a new tab"), browser.Kill())
 	}
 
-	tab, err := browser.NewTab(http.DefaultClient, "")
+	session, err = NewSession(transport, tab.TargetId)
 	if err != nil {
-		return nil, nil, errors.Join(err, errors.New("failed to open a new tab"))
+		return nil, nil, errors.Join(err, errors.New("failed to create a new session"), browser.Kill())
+	}
+
+	cleanup := func() error {
+		return shutdown(browser, transport)
 	}
+	return session, cleanup, nil
+}
 
+func launch(ctx context.Context, logger *slog.Logger, options chrome.Options) (chrome.Chrome, *cdp.Transport, error) {
+	browser, err := chrome.LaunchWithOptions(ctx, options)
+	if err != nil {
+		return browser, nil, errors.Join(err, errors.New("chrome launch failed"))
+	}
+	if browser.IsPipe() {
+		return browser, cdp.New(ctx, cdp.NewPipe(browser.Pipe()), logger), nil
+	}
 	transport, err := cdp.DefaultDial(ctx, browser.WebSocketUrl, logger)
+	if err != nil {
+		return browser, nil, errors.Join(err, errors.New("websocket dial failed"), browser.Kill())
+	}
+	return browser, transport, nil
+}
+
+func shutdown(browser chrome.Chrome, transport *cdp.Transport) error {
+	// graceful close and the exit share the timeout, so a hung browser is terminated in time
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	// the browser is terminated anyway even if the transport is already dead
+	if err := transport.CloseWithContext(ctx); err != nil {
+		transport.Log(slog.LevelWarn, "can't close transport", "error", err.Error())
+	}
+	if err := browser.Shutdown(ctx); err != nil {
+		return errors.Join(err, errors.New("can't shutdown browser"))
+	}
+	return nil
+}
+
+func Connect(ctx context.Context, endpoint string) (session *Session, cancel func() error, err error) {
+	return ConnectWithLogger(ctx, nil, endpoint)
+}
+
+// ConnectWithLogger connects to the already running browser by http://host:port or ws:// debugger url.
+// The session is attached to the first page target not attached by other clients, or to the new one.
+// Returned cleanup detaches from the browser without closing it, only the page created by Connect is closed.
+func ConnectWithLogger(ctx context.Context, logger *slog.Logger, endpoint string) (session *Session, cancel func() error, err error) {
+	webSocketUrl := endpoint
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		version, err := chrome.GetVersion(ctx, http.DefaultClient, endpoint)
+		if err != nil {
+			return nil, nil, errors.Join(err, errors.New("can't resolve browser websocket url"))
+		}
+		webSocketUrl = version.WebSocketDebuggerUrl
+	}
+
+	// ctx bounds the dial only, the connection lives until cleanup
+	conn, _, err := cdp.DefaultDialer.DialContext(ctx, webSocketUrl, nil)
 	if err != nil {
 		return nil, nil, errors.Join(err, errors.New("websocket dial failed"))
 	}
+	transport := cdp.New(context.Background(), conn, logger)
+
+	targetID, created, err := pageTarget(transport)
+	if err != nil {
+		_ = transport.Disconnect()
+		return nil, nil, errors.Join(err, errors.New("failed to find a page target"))
+	}
 
-	session, err = NewSession(transport, target.TargetID(tab.ID))
+	session, err = NewSession(transport, targetID)
 	if err != nil {
+		_ = transport.Disconnect()
 		return nil, nil, errors.Join(err, errors.New("failed to create a new session"))
 	}
 
 	cleanup := func() error {
-		if err := transport.Close(); err != nil {
-			return errors.Join(err, errors.New("can't close transport"))
-		}
-		if err = browser.Wait(); err != nil {
-			return errors.Join(err, errors.New("can't close browser gracefully"))
-		}
-		if userDataDir != "" {
-			if err := os.RemoveAll(userDataDir); err != nil {
-				return errors.Join(err, errors.New("can't clear user data dir"))
+		if created {
+			if err := target.CloseTarget(transport, target.CloseTargetArgs{TargetId: targetID}); err != nil {
+				return errors.Join(err, errors.New("can't close page target"))
+			}
+		} else {
+			if err := target.DetachFromTarget(transport, target.DetachFromTargetArgs{SessionId: target.SessionID(session.sessionID)}); err != nil {
+				return errors.Join(err, errors.New("can't detach from target"))
 			}
 		}
+		if err := transport.Disconnect(); err != nil {
+			return errors.Join(err, errors.New("can't close transport"))
+		}
 		return nil
 	}
 	return session, cleanup, nil
 }
 
+func pageTarget(transport *cdp.Transport) (targetID target.TargetID, created bool, err error) {
+	targets, err := target.GetTargets(transport, target.GetTargetsArgs{})
+	if err != nil {
+		return "", false, err
+	}
+	for _, t := range targets.TargetInfos {
+		if t.Type == "page" && !t.Attached {
+			return t.TargetId, false, nil
+		}
+	}
+	value, err := target.CreateTarget(transport, target.CreateTargetArgs{Url: Blank})
+	if err != nil {
+		return "", false, err
+	}
+	return value.TargetId, true, nil
+}
+
 func Subscribe[T any](s *Session, method string, filter func(T) bool) cdp.Future[T] {
 	var (
 		channel, cancel = s.Subscribe()
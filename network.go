@@ -0,0 +1,139 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ecwid/control/cdp"
+	"github.com/ecwid/control/protocol/common"
+	"github.com/ecwid/control/protocol/network"
+)
+
+type inflightRequests map[network.RequestId]common.FrameId
+
+func (r inflightRequests) add(requestID network.RequestId, frameID common.FrameId) bool {
+	if _, ok := r[requestID]; ok {
+		return false // redirect of the tracked request
+	}
+	r[requestID] = frameID
+	return true
+}
+
+func (r inflightRequests) remove(requestID network.RequestId) bool {
+	if _, ok := r[requestID]; !ok {
+		return false
+	}
+	delete(r, requestID)
+	return true
+}
+
+func (r inflightRequests) update(message cdp.Message, filter func(common.FrameId, string) bool) (changed bool, err error) {
+	switch message.Method {
+
+	case "Network.requestWillBeSent":
+		var event network.RequestWillBeSent
+		if err = json.Unmarshal(message.Params, &event); err != nil {
+			return false, err
+		}
+		if event.Type == "WebSocket" || event.Type == "EventSource" {
+			return false, nil
+		}
+		if !filter(event.FrameId, event.Request.Url) {
+			return false, nil
+		}
+		return r.add(event.RequestId, event.FrameId), nil
+
+	case "Network.loadingFinished":
+		var event network.LoadingFinished
+		if err = json.Unmarshal(message.Params, &event); err != nil {
+			return false, err
+		}
+		return r.remove(event.RequestId), nil
+
+	case "Network.loadingFailed":
+		var event network.LoadingFailed
+		if err = json.Unmarshal(message.Params, &event); err != nil {
+			return false, err
+		}
+		return r.remove(event.RequestId), nil
+	}
+	return false, nil
+}
+
+// WaitNetworkIdle waits until there are no more than maxInflight requests for at least quiet duration.
+// Only requests started after the call are counted, filter (optional) returns false for urls to be ignored,
+// such as long-polling endpoints. Returns ErrNetworkIdleReachedTimeout if ctx deadline is exceeded.
+func (s *Session) WaitNetworkIdle(ctx context.Context, quiet time.Duration, maxInflight int, filter func(url string) bool) error {
+	return s.waitNetworkIdle(ctx, quiet, maxInflight, func(_ common.FrameId, url string) bool {
+		return filter == nil || filter(url)
+	})
+}
+
+func (s *Session) MustWaitNetworkIdle(ctx context.Context, quiet time.Duration, maxInflight int, filter func(url string) bool) {
+	if err := s.WaitNetworkIdle(ctx, quiet, maxInflight, filter); err != nil {
+		panic(err)
+	}
+}
+
+// WaitNetworkIdle is the same as Session.WaitNetworkIdle but counts only requests initiated by this frame
+func (f Frame) WaitNetworkIdle(ctx context.Context, quiet time.Duration, maxInflight int, filter func(url string) bool) error {
+	return f.session.waitNetworkIdle(ctx, quiet, maxInflight, func(frameID common.FrameId, url string) bool {
+		return frameID == f.id && (filter == nil || filter(url))
+	})
+}
+
+func (f Frame) MustWaitNetworkIdle(ctx context.Context, quiet time.Duration, maxInflight int, filter func(url string) bool) {
+	if err := f.WaitNetworkIdle(ctx, quiet, maxInflight, filter); err != nil {
+		panic(err)
+	}
+}
+
+func (s *Session) waitNetworkIdle(ctx context.Context, quiet time.Duration, maxInflight int, filter func(common.FrameId, string) bool) error {
+	channel, cancel := s.Subscribe()
+	defer cancel()
+
+	var (
+		inflight = inflightRequests{}
+		timer    = time.NewTimer(quiet)
+	)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return ErrNetworkIdleReachedTimeout
+			}
+			return context.Cause(ctx)
+
+		case <-s.context.Done():
+			return context.Cause(s.context)
+
+		case <-timer.C:
+			return nil
+
+		case message, ok := <-channel:
+			if !ok {
+				return context.Cause(s.context)
+			}
+			changed, err := inflight.update(message, filter)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				continue
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			if len(inflight) <= maxInflight {
+				timer.Reset(quiet)
+			}
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/ecwid/control/protocol/dom"
 	"github.com/ecwid/control/protocol/overlay"
 	"github.com/ecwid/control/protocol/runtime"
+	"github.com/ecwid/control/protocol/target"
 )
 
 type (
@@ -18,6 +19,8 @@ type (
 	NodeNonFocusableError string
 	NodeInvisibleError    string
 	NodeUnstableError     string
+	NodeDisabledError     string
+	NodeDetachedError     string
 	NoSuchSelectorError   string
 )
 
@@ -33,6 +36,14 @@ func (n NodeUnstableError) Error() string {
 	return fmt.Sprintf("selector `%s` is not stable", string(n))
 }
 
+func (n NodeDisabledError) Error() string {
+	return fmt.Sprintf("selector `%s` is disabled", string(n))
+}
+
+func (n NodeDetachedError) Error() string {
+	return fmt.Sprintf("selector `%s` is detached from document", string(n))
+}
+
 func (n NodeNonFocusableError) Error() string {
 	return fmt.Sprintf("selector `%s` is not focusable", string(n))
 }
@@ -194,7 +205,7 @@ func (e Node) Call(method string, send, recv any) error {
 }
 
 func (e Node) IsConnected() bool {
-	value, err := e.eval(`function(){return this.isConnected}`)
+	value, err := e.utilityEval(`function(){return this.isConnected}`)
 	if err != nil {
 		return false
 	}
@@ -205,8 +216,17 @@ func (e Node) MustReleaseObject() {
 	panicIfError(e.ReleaseObject())
 }
 
+// ReleaseObject releases the node's handle and handles of the node adopted by isolated worlds
 func (e Node) ReleaseObject() error {
-	err := runtime.ReleaseObject(e, runtime.ReleaseObjectArgs{ObjectId: e.GetRemoteObjectID()})
+	err := releaseObject(e, e.GetRemoteObjectID())
+	for _, id := range e.frame.session.frames.forgetNode(e.GetRemoteObjectID()) {
+		err = errors.Join(err, releaseObject(e, id))
+	}
+	return err
+}
+
+func releaseObject(e Node, id runtime.RemoteObjectId) error {
+	err := runtime.ReleaseObject(e, runtime.ReleaseObjectArgs{ObjectId: id})
 	if err != nil && err.Error() == `Cannot find context with specified id` {
 		return nil
 	}
@@ -217,6 +237,44 @@ func (e Node) eval(function string, args ...any) (any, error) {
 	return e.frame.CallFunctionOn(e, function, true, args...)
 }
 
+// utilityEval calls the function on the node resolved in the utility world,
+// it doesn't see globals and prototypes overridden by the page
+func (e Node) utilityEval(function string, args ...any) (any, error) {
+	node, err := e.adopt(UtilityWorld)
+	if err != nil {
+		return nil, err
+	}
+	return node.eval(function, args...)
+}
+
+// adopt resolves the same DOM node in the world of the frame,
+// the handle is kept until the node is released or the world's context is destroyed, so helpers don't resolve the node again
+func (e Node) adopt(world World) (*Node, error) {
+	context, err := e.frame.executionContext(world)
+	if err != nil {
+		return nil, err
+	}
+	node := &Node{requestedSelector: e.requestedSelector, frame: e.frame}
+	if id, ok := e.frame.session.frames.adoptedNode(e.GetRemoteObjectID(), context.id); ok {
+		node.object = remoteObjectValue(id)
+		return node, nil
+	}
+	description, err := e.frame.describeNode(e)
+	if err != nil {
+		return nil, err
+	}
+	value, err := dom.ResolveNode(e, dom.ResolveNodeArgs{
+		BackendNodeId:      description.BackendNodeId,
+		ExecutionContextId: context.id,
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.frame.session.frames.nodeAdopted(e.GetRemoteObjectID(), context.id, value.Object.ObjectId)
+	node.object = remoteObjectValue(value.Object.ObjectId)
+	return node, nil
+}
+
 func (e Node) asyncEval(function string, args ...any) (RemoteObject, error) {
 	value, err := e.frame.CallFunctionOn(e, function, false, args...)
 	if err != nil {
@@ -229,7 +287,7 @@ func (e Node) asyncEval(function string, args ...any) (RemoteObject, error) {
 }
 
 func (e Node) dispatchEvents(events ...any) error {
-	_, err := e.eval(`function(l){for(const e of l)this.dispatchEvent(new Event(e,{'bubbles':!0}))}`, events)
+	_, err := e.utilityEval(`function(l){for(const e of l)this.dispatchEvent(new Event(e,{'bubbles':!0}))}`, events)
 	return err
 }
 
@@ -311,9 +369,14 @@ func (e *Node) contentFrame() (*Frame, error) {
 	if err != nil {
 		return nil, err
 	}
+	session := e.frame.session
+	// cross-origin iframe is a separate target with its own session
+	if child, ok := session.child(target.TargetID(value.FrameId)); ok {
+		session = child
+	}
 	return &Frame{
 		id:      value.FrameId,
-		session: e.frame.session,
+		session: session,
 		parent:  e.frame,
 		node:    e,
 	}, nil
@@ -361,7 +424,7 @@ func (e Node) MustBlur() {
 }
 
 func (e Node) clearInput() error {
-	_, err := e.eval(`function(){('INPUT'===this.nodeName||'TEXTAREA'===this.nodeName)?this.select():this.innerText=''}`)
+	_, err := e.utilityEval(`function(){('INPUT'===this.nodeName||'TEXTAREA'===this.nodeName)?this.select():this.innerText=''}`)
 	if err != nil {
 		return err
 	}
@@ -404,10 +467,18 @@ func (e Node) MustCheckVisibility() bool {
 }
 
 func (e Node) CheckVisibility() Optional[bool] {
-	value, err := e.eval(`function(){return this.checkVisibility({opacityProperty: false, visibilityProperty: true})}`)
+	value, err := e.utilityEval(`function(){return this.checkVisibility({opacityProperty: false, visibilityProperty: true})}`)
 	return optional[bool](value, err)
 }
 
+func (e Node) IsEnabled() Optional[bool] {
+	return optional[bool](e.utilityEval(`function(){return !this.matches(':disabled')}`))
+}
+
+func (e Node) MustIsEnabled() bool {
+	return e.IsEnabled().MustGetValue()
+}
+
 func (e Node) Upload(files ...string) error {
 	return dom.SetFileInputFiles(e, dom.SetFileInputFilesArgs{
 		ObjectId: e.GetRemoteObjectID(),
@@ -430,7 +501,7 @@ func (e Node) Click() (err error) {
 
 	future := e.frame.session.funcCalled(hitCheckFunc)
 	defer future.Cancel()
-	_, err = e.eval(`function(func) {
+	_, err = e.utilityEval(`function(func) {
 		let a = window[func],
 			d = (b) => {
 				for (let d = b; d; d = d.parentNode) {
@@ -485,7 +556,7 @@ func (e Node) Down() (err error) {
 	future := e.frame.session.funcCalled(hitCheckFunc)
 	defer future.Cancel()
 
-	_, err = e.eval(`function(func) {
+	_, err = e.utilityEval(`function(func) {
 		let a = window[func],
 			d = (b) => {
 				for (let d = b; d; d = d.parentNode) {
@@ -546,7 +617,7 @@ func (e Node) clickablePoint() (middle Point, err error) {
 	if err != nil {
 		return middle, err
 	}
-	_, err = e.frame.evaluate(`new Promise(r => setTimeout(r,100))`, true)
+	_, err = e.frame.evaluateIn(UtilityWorld, `new Promise(r => setTimeout(r,100))`, true)
 	if err != nil {
 		return middle, err
 	}
@@ -555,10 +626,14 @@ func (e Node) clickablePoint() (middle Point, err error) {
 		return middle, err
 	}
 	middle = r0.Middle()
-	if middle.Equal(r1.Middle()) {
-		return middle, nil
+	if !middle.Equal(r1.Middle()) {
+		return middle, NodeUnstableError(e.requestedSelector)
 	}
-	return middle, NodeUnstableError(e.requestedSelector)
+	offset, err := e.frame.viewportOffset()
+	if err != nil {
+		return middle, err
+	}
+	return Point{X: middle.X + offset.X, Y: middle.Y + offset.Y}, nil
 }
 
 func (e Node) GetBoundingClientRect() Optional[dom.Rect] {
@@ -570,23 +645,15 @@ func (e Node) MustGetBoundingClientRect() dom.Rect {
 }
 
 func (e Node) getBoundingClientRect() (dom.Rect, error) {
-	value, err := e.eval(`function() {
+	value, err := e.utilityEval(`function() {
 		const e = this.getBoundingClientRect()
 		const t = this.ownerDocument.documentElement.getBoundingClientRect()
-		return [e.left - t.left, e.top - t.top, e.width, e.height]
+		return {x: e.left - t.left, y: e.top - t.top, width: e.width, height: e.height}
 	}`)
 	if err != nil {
 		return dom.Rect{}, err
 	}
-	if arr, ok := value.([]any); ok {
-		return dom.Rect{
-			X:      arr[0].(float64),
-			Y:      arr[1].(float64),
-			Width:  arr[2].(float64),
-			Height: arr[3].(float64),
-		}, nil
-	}
-	return dom.Rect{}, errors.New("getBoundingClientRect: eval result is not array")
+	return decodeAs[dom.Rect](value).Unwrap()
 }
 
 func (e Node) getContentQuad() (Quad, error) {
@@ -675,7 +742,7 @@ func (e Node) getViewportRectangle() (dom.Rect, error) {
 }
 
 func (e Node) SelectByValues(values ...string) error {
-	_, err := e.eval(`function(a){const b=Array.from(this.options);this.value=void 0;for(const c of b)if(c.selected=a.includes(c.value),c.selected&&!this.multiple)break}`, values)
+	_, err := e.utilityEval(`function(a){const b=Array.from(this.options);this.value=void 0;for(const c of b)if(c.selected=a.includes(c.value),c.selected&&!this.multiple)break}`, values)
 	if err != nil {
 		return err
 	}
@@ -695,15 +762,11 @@ func (e Node) MustGetSelected(textContent bool) []string {
 }
 
 func (e Node) getSelected(textContent bool) ([]string, error) {
-	values, err := e.eval(`function(text){return Array.from(this.options).filter(a=>a.selected).map(a=>text?a.textContent.trim():a.value)}`, textContent)
+	values, err := e.utilityEval(`function(text){return Array.from(this.options).filter(a=>a.selected).map(a=>text?a.textContent.trim():a.value)}`, textContent)
 	if err != nil {
 		return nil, err
 	}
-	stringsValues := make([]string, len(values.([]any)))
-	for n, val := range values.([]any) {
-		stringsValues[n] = val.(string)
-	}
-	return stringsValues, nil
+	return decodeAs[[]string](values).Unwrap()
 }
 
 func (e Node) SetCheckbox(check bool) error {
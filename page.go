@@ -1,9 +1,14 @@
 package control
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 
+	"github.com/ecwid/control/cdp"
 	"github.com/ecwid/control/protocol/common"
+	"github.com/ecwid/control/protocol/dom"
+	"github.com/ecwid/control/protocol/network"
 	"github.com/ecwid/control/protocol/page"
 )
 
@@ -47,11 +52,25 @@ func (f Frame) GetID() common.FrameId {
 	return f.id
 }
 
-func (f Frame) executionContextID() string {
-	if value, ok := f.session.frames.Load(f.id); ok {
-		return value.(string)
+// executionContext returns the frame's context of the world, isolated worlds are created on demand
+func (f Frame) executionContext(world World) (executionContext, error) {
+	if value, ok := f.session.frames.context(f.id, world); ok {
+		return value, nil
 	}
-	return ""
+	if world == MainWorld {
+		return executionContext{}, ErrExecutionContextDestroyed
+	}
+	return f.session.frames.createWorld(f.id, world, func() (executionContext, error) {
+		value, err := page.CreateIsolatedWorld(f, page.CreateIsolatedWorldArgs{
+			FrameId:             f.id,
+			WorldName:           string(world),
+			GrantUniveralAccess: true,
+		})
+		if err != nil {
+			return executionContext{}, err
+		}
+		return executionContext{id: value.ExecutionContextId}, nil
+	})
 }
 
 func (f Frame) Call(method string, send, recv any) error {
@@ -66,6 +85,27 @@ func (f *Frame) Parent() *Frame {
 	return f.parent
 }
 
+// viewportOffset returns position of the frame's viewport in the page,
+// content quads of out-of-process iframes are relative to their own viewport which starts at the content box of the owner
+func (f *Frame) viewportOffset() (offset Point, err error) {
+	for frame := f; frame.parent != nil; frame = frame.parent {
+		if frame.session == frame.parent.session {
+			continue
+		}
+		owner, err := frame.owner()
+		if err != nil {
+			return offset, err
+		}
+		box, err := dom.GetBoxModel(owner, dom.GetBoxModelArgs{ObjectId: owner.GetRemoteObjectID()})
+		if err != nil {
+			return offset, err
+		}
+		offset.X += box.Model.Content[0]
+		offset.Y += box.Model.Content[1]
+	}
+	return offset, nil
+}
+
 func (f Frame) Log(msg string, args ...any) {
 	args = append(args, "frameId", f.id)
 	f.session.Log(msg, args...)
@@ -94,6 +134,153 @@ func (f Frame) MustNavigate(url string) {
 	}
 }
 
+// NavigateAndWait navigates the frame and waits for the lifecycle event of the document loaded by the navigation,
+// same-document navigation is complete when Page.navigate returns
+func (f Frame) NavigateAndWait(url string, until LifecycleEventType) error {
+	var loader = make(chan network.LoaderId, 1)
+	future := f.loaderReached(loader, until)
+	defer future.Cancel()
+	nav, err := page.Navigate(f, page.NavigateArgs{
+		Url:     url,
+		FrameId: f.id,
+	})
+	if err != nil {
+		return err
+	}
+	if nav.ErrorText != "" {
+		return errors.New(nav.ErrorText)
+	}
+	if nav.LoaderId == "" {
+		return nil
+	}
+	loader <- nav.LoaderId
+	ctx, cancel := context.WithTimeout(f.session.context, f.session.timeout)
+	defer cancel()
+	_, err = future.Get(ctx)
+	return err
+}
+
+func (f Frame) MustNavigateAndWait(url string, until LifecycleEventType) {
+	if err := f.NavigateAndWait(url, until); err != nil {
+		panic(err)
+	}
+}
+
+// WaitForNavigation calls trigger and waits until the document loaded by it fires the lifecycle event.
+// Same-document navigations (history API, anchors) complete without lifecycle events.
+func (f Frame) WaitForNavigation(trigger func() error, until LifecycleEventType) error {
+	future := f.lifecycleReached(until)
+	defer future.Cancel()
+	if err := trigger(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(f.session.context, f.session.timeout)
+	defer cancel()
+	_, err := future.Get(ctx)
+	return err
+}
+
+func (f Frame) MustWaitForNavigation(trigger func() error, until LifecycleEventType) {
+	if err := f.WaitForNavigation(trigger, until); err != nil {
+		panic(err)
+	}
+}
+
+func (f Frame) lifecycleReached(until LifecycleEventType) cdp.Future[network.LoaderId] {
+	var channel, cancel = f.session.Subscribe()
+	callback := func(resolve func(network.LoaderId), reject func(error)) {
+		// loader of the document started after the subscription
+		var loaderID network.LoaderId
+		for value := range channel {
+			switch value.Method {
+
+			case "Page.lifecycleEvent":
+				var event page.LifecycleEvent
+				if err := json.Unmarshal(value.Params, &event); err != nil {
+					reject(err)
+					return
+				}
+				if event.FrameId != f.id {
+					continue
+				}
+				if event.Name == string(LifecycleInit) {
+					loaderID = event.LoaderId
+				}
+				if loaderID != "" && loaderID == event.LoaderId && event.Name == string(until) {
+					resolve(loaderID)
+					return
+				}
+
+			case "Page.frameNavigated":
+				var event page.FrameNavigated
+				if err := json.Unmarshal(value.Params, &event); err != nil {
+					reject(err)
+					return
+				}
+				if event.Frame.Id == f.id {
+					loaderID = event.Frame.LoaderId
+				}
+
+			case "Page.navigatedWithinDocument":
+				var event page.NavigatedWithinDocument
+				if err := json.Unmarshal(value.Params, &event); err != nil {
+					reject(err)
+					return
+				}
+				if event.FrameId == f.id && loaderID == "" {
+					resolve(loaderID)
+					return
+				}
+			}
+		}
+	}
+	return cdp.NewPromise(callback, cancel)
+}
+
+// loaderReached resolves when the document of the loader sent to the channel fires the lifecycle event,
+// events which come before the loader is known are remembered
+func (f Frame) loaderReached(loader chan network.LoaderId, until LifecycleEventType) cdp.Future[network.LoaderId] {
+	var channel, cancel = f.session.Subscribe()
+	callback := func(resolve func(network.LoaderId), reject func(error)) {
+		var (
+			expected network.LoaderId
+			reached  = map[network.LoaderId]bool{}
+		)
+		for {
+			select {
+			case expected = <-loader:
+				if reached[expected] {
+					resolve(expected)
+					return
+				}
+				loader = nil
+			case value, ok := <-channel:
+				if !ok {
+					return
+				}
+				if value.Method != "Page.lifecycleEvent" {
+					continue
+				}
+				var event page.LifecycleEvent
+				if err := json.Unmarshal(value.Params, &event); err != nil {
+					reject(err)
+					return
+				}
+				if event.FrameId != f.id || event.Name != string(until) {
+					continue
+				}
+				if expected == "" {
+					reached[event.LoaderId] = true
+				} else if event.LoaderId == expected {
+					resolve(expected)
+					return
+				}
+			}
+		}
+	}
+	return cdp.NewPromise(callback, cancel)
+}
+
 func (f Frame) Reload(ignoreCache bool, scriptToEvaluateOnLoad string) error {
 	return page.Reload(f, page.ReloadArgs{
 		IgnoreCache:            ignoreCache,
@@ -111,6 +298,19 @@ func (f Frame) Evaluate(expression string, awaitPromise bool) Optional[any] {
 	return optional[any](f.evaluate(expression, awaitPromise))
 }
 
+func (f Frame) MustEvaluate(expression string, awaitPromise bool) any {
+	return f.Evaluate(expression, awaitPromise).MustGetValue()
+}
+
+// EvaluateIn evaluates the expression in the world of the frame, the isolated world is created if it doesn't exist
+func (f Frame) EvaluateIn(world World, expression string, awaitPromise bool) Optional[any] {
+	return optional[any](f.evaluateIn(world, expression, awaitPromise))
+}
+
+func (f Frame) MustEvaluateIn(world World, expression string, awaitPromise bool) any {
+	return f.EvaluateIn(world, expression, awaitPromise).MustGetValue()
+}
+
 func (f Frame) Document() Optional[*Node] {
 	opt := optional[*Node](f.evaluate("document", true))
 	if opt.err == nil && opt.value == nil {
@@ -131,6 +331,7 @@ func (f Frame) Query(cssSelector string) Optional[*Node] {
 	if err != nil {
 		return Optional[*Node]{err: err}
 	}
+	defer doc.release()
 	return doc.Query(cssSelector)
 }
 
@@ -143,5 +344,6 @@ func (f Frame) QueryAll(cssSelector string) Optional[NodeList] {
 	if err != nil {
 		return Optional[NodeList]{err: err}
 	}
+	defer doc.release()
 	return doc.QueryAll(cssSelector)
 }
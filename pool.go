@@ -0,0 +1,264 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ecwid/control/cdp"
+	"github.com/ecwid/control/chrome"
+)
+
+var ErrPoolClosed = errors.New("pool is closed")
+
+type PoolOptions struct {
+	// Size is a number of browsers kept running
+	Size int
+	// MaxUses is a number of leases after which the browser is restarted, 0 means unlimited
+	MaxUses int
+	Launch  chrome.Options
+	Logger  *slog.Logger
+}
+
+type PoolStats struct {
+	Size     int
+	Idle     int
+	InUse    int
+	Leases   int64
+	Launched int64
+	Recycled int64
+	Crashed  int64
+}
+
+type pooledBrowser struct {
+	chrome    chrome.Chrome
+	transport *cdp.Transport
+	uses      int
+}
+
+func (b *pooledBrowser) healthy() bool {
+	select {
+	case <-b.transport.Context().Done():
+		return false
+	default:
+		return true
+	}
+}
+
+// Pool keeps browsers running and leases each of them exclusively with a session in a fresh browser context
+type Pool struct {
+	context  context.Context
+	options  PoolOptions
+	idle     chan *pooledBrowser
+	mutex    sync.Mutex
+	closed   bool
+	inUse    atomic.Int32
+	leases   atomic.Int64
+	launched atomic.Int64
+	recycled atomic.Int64
+	crashed  atomic.Int64
+	warmup   sync.WaitGroup
+}
+
+// NewPool launches options.Size browsers, ctx limits the lifetime of the browsers
+func NewPool(ctx context.Context, options PoolOptions) (*Pool, error) {
+	if options.Size < 1 {
+		options.Size = 1
+	}
+	pool := &Pool{
+		context: ctx,
+		options: options,
+		idle:    make(chan *pooledBrowser, options.Size),
+	}
+	for i := 0; i < options.Size; i++ {
+		browser, err := pool.launch()
+		if err != nil {
+			return nil, errors.Join(err, pool.Close())
+		}
+		pool.idle <- browser
+	}
+	return pool, nil
+}
+
+func (p *Pool) launch() (*pooledBrowser, error) {
+	browser, transport, err := launch(p.context, p.options.Logger, p.options.Launch)
+	if err != nil {
+		return nil, err
+	}
+	p.launched.Add(1)
+	return &pooledBrowser{chrome: browser, transport: transport}, nil
+}
+
+// relaunch replaces the browser with the new one in background, nil is put back if launch fails
+func (p *Pool) relaunch(browser *pooledBrowser) {
+	p.recycled.Add(1)
+	p.warmup.Add(1)
+	go func() {
+		defer p.warmup.Done()
+		if err := shutdown(browser.chrome, browser.transport); err != nil {
+			browser.transport.Log(slog.LevelWarn, "can't shutdown pooled browser", "error", err.Error())
+		}
+		if p.isClosed() {
+			return
+		}
+		value, err := p.launch()
+		if err != nil {
+			value = nil
+			if p.options.Logger != nil {
+				p.options.Logger.Warn("can't relaunch pooled browser", "error", err.Error())
+			}
+		}
+		p.put(value)
+	}()
+}
+
+func (p *Pool) put(browser *pooledBrowser) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		if browser != nil {
+			_ = shutdown(browser.chrome, browser.transport)
+		}
+		return
+	}
+	p.idle <- browser
+}
+
+func (p *Pool) isClosed() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.closed
+}
+
+// Acquire waits for the free browser and opens a page in the new browser context
+func (p *Pool) Acquire(ctx context.Context) (*Lease, error) {
+	var browser *pooledBrowser
+	select {
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	case browser = <-p.idle:
+	}
+	if p.isClosed() {
+		p.put(browser)
+		return nil, ErrPoolClosed
+	}
+	var err error
+	if browser == nil || !browser.healthy() {
+		if browser != nil {
+			p.crashed.Add(1)
+			_ = shutdown(browser.chrome, browser.transport)
+		}
+		if browser, err = p.launch(); err != nil {
+			p.put(nil)
+			return nil, err
+		}
+	}
+	lease, err := p.lease(browser)
+	if err != nil {
+		p.crashed.Add(1)
+		p.relaunch(browser)
+		return nil, err
+	}
+	p.inUse.Add(1)
+	p.leases.Add(1)
+	return lease, nil
+}
+
+func (p *Pool) MustAcquire(ctx context.Context) *Lease {
+	lease, err := p.Acquire(ctx)
+	if err != nil {
+		panic(err)
+	}
+	return lease
+}
+
+func (p *Pool) lease(browser *pooledBrowser) (*Lease, error) {
+	browserContext, err := NewBrowserContext(browser.transport, BrowserContextOptions{})
+	if err != nil {
+		return nil, err
+	}
+	session, err := browserContext.NewPage()
+	if err != nil {
+		return nil, err
+	}
+	return &Lease{
+		Session:        session,
+		BrowserContext: browserContext,
+		pool:           p,
+		browser:        browser,
+	}, nil
+}
+
+func (p *Pool) Stats() PoolStats {
+	inUse := int(p.inUse.Load())
+	return PoolStats{
+		Size:     p.options.Size,
+		Idle:     len(p.idle),
+		InUse:    inUse,
+		Leases:   p.leases.Load(),
+		Launched: p.launched.Load(),
+		Recycled: p.recycled.Load(),
+		Crashed:  p.crashed.Load(),
+	}
+}
+
+// Close shuts down idle browsers, the leased ones are shut down on release
+func (p *Pool) Close() error {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mutex.Unlock()
+
+	p.warmup.Wait()
+	var errs []error
+	for {
+		select {
+		case browser := <-p.idle:
+			if browser != nil {
+				errs = append(errs, shutdown(browser.chrome, browser.transport))
+			}
+		default:
+			return errors.Join(errs...)
+		}
+	}
+}
+
+type Lease struct {
+	Session        *Session
+	BrowserContext *BrowserContext
+	pool           *Pool
+	browser        *pooledBrowser
+	once           sync.Once
+}
+
+// Release disposes the browser context of the lease and returns the browser to the pool.
+// The browser is restarted if the page crashed or it has been used PoolOptions.MaxUses times
+func (l *Lease) Release() (err error) {
+	l.once.Do(func() {
+		p := l.pool
+		defer p.inUse.Add(-1)
+		var crashed TargetCrashedError
+		if errors.As(context.Cause(l.Session.Context()), &crashed) || !l.browser.healthy() {
+			p.crashed.Add(1)
+			p.relaunch(l.browser)
+			return
+		}
+		err = l.BrowserContext.Close()
+		l.browser.uses++
+		if err != nil || (p.options.MaxUses > 0 && l.browser.uses >= p.options.MaxUses) {
+			p.relaunch(l.browser)
+			return
+		}
+		p.put(l.browser)
+	})
+	return err
+}
+
+func (l *Lease) MustRelease() {
+	panicIfError(l.Release())
+}
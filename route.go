@@ -0,0 +1,372 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ecwid/control/protocol/common"
+	"github.com/ecwid/control/protocol/fetch"
+	"github.com/ecwid/control/protocol/network"
+)
+
+const (
+	ErrorReasonFailed               network.ErrorReason = "Failed"
+	ErrorReasonAborted              network.ErrorReason = "Aborted"
+	ErrorReasonTimedOut             network.ErrorReason = "TimedOut"
+	ErrorReasonAccessDenied         network.ErrorReason = "AccessDenied"
+	ErrorReasonConnectionClosed     network.ErrorReason = "ConnectionClosed"
+	ErrorReasonConnectionReset      network.ErrorReason = "ConnectionReset"
+	ErrorReasonConnectionRefused    network.ErrorReason = "ConnectionRefused"
+	ErrorReasonConnectionAborted    network.ErrorReason = "ConnectionAborted"
+	ErrorReasonConnectionFailed     network.ErrorReason = "ConnectionFailed"
+	ErrorReasonNameNotResolved      network.ErrorReason = "NameNotResolved"
+	ErrorReasonInternetDisconnected network.ErrorReason = "InternetDisconnected"
+	ErrorReasonAddressUnreachable   network.ErrorReason = "AddressUnreachable"
+	ErrorReasonBlockedByClient      network.ErrorReason = "BlockedByClient"
+	ErrorReasonBlockedByResponse    network.ErrorReason = "BlockedByResponse"
+)
+
+var ErrRequestAlreadyHandled = errors.New("intercepted request is already handled")
+
+// ContinueOverrides are the request parameters to be replaced, empty fields are sent unchanged
+type ContinueOverrides struct {
+	Url    string
+	Method string
+	// Headers are merged into the request headers, a header with the same name in any case is replaced
+	Headers  map[string]string
+	PostData []byte
+}
+
+type FulfillResponse struct {
+	Status  int
+	Headers map[string]string
+	Body    []byte
+}
+
+// InterceptedRequest is a request paused by the Fetch domain and passed to the route handler.
+// Handler must call one of Continue, Fulfill, FulfillFile or Abort,
+// otherwise the request is passed to the next matching route
+type InterceptedRequest struct {
+	session      *Session
+	id           fetch.RequestId
+	Request      *network.Request
+	FrameID      common.FrameId
+	ResourceType network.ResourceType
+	mutex        sync.Mutex
+	handled      bool
+}
+
+func (r *InterceptedRequest) Call(method string, send, recv any) error {
+	return r.session.Call(method, send, recv)
+}
+
+func (r *InterceptedRequest) Url() string {
+	return r.Request.Url
+}
+
+func (r *InterceptedRequest) Method() string {
+	return r.Request.Method
+}
+
+func (r *InterceptedRequest) PostData() string {
+	return r.Request.PostData
+}
+
+func (r *InterceptedRequest) Headers() map[string]string {
+	return headersToMap(r.Request.Headers)
+}
+
+func (r *InterceptedRequest) IsHandled() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.handled
+}
+
+func (r *InterceptedRequest) handle(function func() error) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.handled {
+		return ErrRequestAlreadyHandled
+	}
+	r.handled = true
+	return function()
+}
+
+func (r *InterceptedRequest) Continue(overrides ContinueOverrides) error {
+	return r.handle(func() error {
+		return fetch.ContinueRequest(r, fetch.ContinueRequestArgs{
+			RequestId: r.id,
+			Url:       overrides.Url,
+			Method:    overrides.Method,
+			PostData:  overrides.PostData,
+			Headers:   toHeaderEntries(r.mergeHeaders(overrides.Headers)),
+		})
+	})
+}
+
+// mergeHeaders returns the request headers with the overrides, nil if there are none to keep the headers unchanged
+func (r *InterceptedRequest) mergeHeaders(overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return nil
+	}
+	var headers = r.Headers()
+	for name, value := range overrides {
+		for key := range headers {
+			if strings.EqualFold(key, name) {
+				delete(headers, key)
+			}
+		}
+		headers[name] = value
+	}
+	return headers
+}
+
+func (r *InterceptedRequest) Fulfill(response FulfillResponse) error {
+	if response.Status == 0 {
+		response.Status = http.StatusOK
+	}
+	return r.fulfill(response.Status, toHeaderEntries(response.Headers), response.Body)
+}
+
+func (r *InterceptedRequest) fulfill(status int, headers []*fetch.HeaderEntry, body []byte) error {
+	return r.handle(func() error {
+		return fetch.FulfillRequest(r, fetch.FulfillRequestArgs{
+			RequestId:       r.id,
+			ResponseCode:    status,
+			ResponseHeaders: headers,
+			Body:            body,
+		})
+	})
+}
+
+// FulfillFile responds with the file content, Content-Type is detected by the file extension if not set
+func (r *InterceptedRequest) FulfillFile(status int, filename string, headers map[string]string) error {
+	body, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	if _, ok := headers["Content-Type"]; !ok {
+		if contentType := mime.TypeByExtension(filepath.Ext(filename)); contentType != "" {
+			headers["Content-Type"] = contentType
+		} else {
+			headers["Content-Type"] = http.DetectContentType(body)
+		}
+	}
+	return r.Fulfill(FulfillResponse{Status: status, Headers: headers, Body: body})
+}
+
+func (r *InterceptedRequest) Abort(reason network.ErrorReason) error {
+	return r.handle(func() error {
+		return fetch.FailRequest(r, fetch.FailRequestArgs{
+			RequestId:   r.id,
+			ErrorReason: reason,
+		})
+	})
+}
+
+// headersToMap converts headers of the protocol, they are passed as *network.Headers holding the JSON object
+func headersToMap(headers network.Headers) map[string]string {
+	var value = map[string]string{}
+	if p, ok := headers.(*network.Headers); ok && p != nil {
+		headers = *p
+	}
+	if h, ok := headers.(map[string]any); ok {
+		for k, v := range h {
+			value[k] = fmt.Sprint(v)
+		}
+	}
+	return value
+}
+
+func toHeaderEntries(headers map[string]string) []*fetch.HeaderEntry {
+	if headers == nil {
+		return nil
+	}
+	var entries = make([]*fetch.HeaderEntry, 0, len(headers))
+	for name, value := range headers {
+		entries = append(entries, &fetch.HeaderEntry{Name: name, Value: value})
+	}
+	return entries
+}
+
+// urlPattern compiles a wildcard pattern where `*` matches any sequence of characters and `?` matches a single one
+func urlPattern(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteByte('^')
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteByte('.')
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteByte('$')
+	return regexp.Compile(b.String())
+}
+
+type route struct {
+	pattern *regexp.Regexp
+	handler func(*InterceptedRequest)
+}
+
+// routeTable is shared by the page session and its auto-attached children, so routes intercept requests of
+// out-of-process iframes too
+type routeTable struct {
+	mutex  sync.Mutex
+	routes []*route
+	// sessions sharing the table with their Fetch.requestPaused subscriptions, nil if interception is disabled
+	sessions map[*Session]func()
+}
+
+func (t *routeTable) match(url string) []*route {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var matched []*route
+	for _, r := range t.routes {
+		if r.pattern.MatchString(url) {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// Route intercepts requests with url matching the wildcard pattern.
+// Routes are tried in registration order, unhandled requests are continued unchanged.
+func (s *Session) Route(pattern string, handler func(*InterceptedRequest)) (unroute func() error, err error) {
+	re, err := urlPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	r := &route{pattern: re, handler: handler}
+
+	s.routes.mutex.Lock()
+	defer s.routes.mutex.Unlock()
+	if len(s.routes.routes) == 0 {
+		for session := range s.routes.sessions {
+			err = session.enableInterception()
+			if err != nil && !session.IsDone() {
+				s.routes.disableInterception()
+				return nil, err
+			}
+		}
+	}
+	s.routes.routes = append(s.routes.routes, r)
+	return func() error { return s.unroute(r) }, nil
+}
+
+func (s *Session) MustRoute(pattern string, handler func(*InterceptedRequest)) (unroute func() error) {
+	unroute, err := s.Route(pattern, handler)
+	if err != nil {
+		panic(err)
+	}
+	return unroute
+}
+
+func (s *Session) unroute(r *route) error {
+	s.routes.mutex.Lock()
+	defer s.routes.mutex.Unlock()
+	for n, value := range s.routes.routes {
+		if value == r {
+			s.routes.routes = append(s.routes.routes[:n], s.routes.routes[n+1:]...)
+			if len(s.routes.routes) == 0 {
+				return s.routes.disableInterception()
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// routesTo shares routes of the session with the auto-attached child session and intercepts its requests if there are any
+func (s *Session) routesTo(child *Session) error {
+	s.routes.mutex.Lock()
+	defer s.routes.mutex.Unlock()
+	child.routes = s.routes
+	s.routes.sessions[child] = nil
+	if len(s.routes.routes) == 0 {
+		return nil
+	}
+	return child.enableInterception()
+}
+
+// leaveRoutes stops interception of the detached child session
+func (s *Session) leaveRoutes(child *Session) {
+	s.routes.mutex.Lock()
+	defer s.routes.mutex.Unlock()
+	if cancel := s.routes.sessions[child]; cancel != nil {
+		cancel()
+	}
+	delete(s.routes.sessions, child)
+}
+
+// enableInterception subscribes to paused requests of the session, the caller must hold the lock of the table
+func (s *Session) enableInterception() error {
+	channel, cancel := s.Subscribe()
+	go func() {
+		for message := range channel {
+			if message.Method == "Fetch.requestPaused" {
+				var paused fetch.RequestPaused
+				if err := json.Unmarshal(message.Params, &paused); err != nil {
+					s.Log("can't unmarshal Fetch.requestPaused", err)
+					continue
+				}
+				go s.handleRequestPaused(paused)
+			}
+		}
+	}()
+	if err := fetch.Enable(s, fetch.EnableArgs{Patterns: []*fetch.RequestPattern{{UrlPattern: "*"}}}); err != nil {
+		cancel()
+		return err
+	}
+	s.routes.sessions[s] = cancel
+	return nil
+}
+
+// disableInterception stops interception of all sessions of the table, the caller must hold the lock
+func (t *routeTable) disableInterception() error {
+	var err error
+	for session, cancel := range t.sessions {
+		if cancel == nil {
+			continue
+		}
+		cancel()
+		t.sessions[session] = nil
+		if e := fetch.Disable(session); e != nil && !session.IsDone() {
+			err = errors.Join(err, e)
+		}
+	}
+	return err
+}
+
+func (s *Session) handleRequestPaused(paused fetch.RequestPaused) {
+	request := &InterceptedRequest{
+		session:      s,
+		id:           paused.RequestId,
+		Request:      paused.Request,
+		FrameID:      paused.FrameId,
+		ResourceType: paused.ResourceType,
+	}
+	for _, r := range s.routes.match(paused.Request.Url) {
+		r.handler(request)
+		if request.IsHandled() {
+			return
+		}
+	}
+	if err := request.Continue(ContinueOverrides{}); err != nil && err != ErrRequestAlreadyHandled {
+		s.Log("can't continue intercepted request", err, "url", paused.Request.Url)
+	}
+}
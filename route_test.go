@@ -0,0 +1,40 @@
+package control
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ecwid/control/protocol/network"
+)
+
+func TestMergeHeaders(t *testing.T) {
+	var headers network.Headers = map[string]any{
+		"Accept":       "text/html",
+		"content-type": "text/plain",
+	}
+	request := &InterceptedRequest{Request: &network.Request{Headers: &headers}}
+	tests := []struct {
+		name      string
+		overrides map[string]string
+		expected  map[string]string
+	}{
+		{name: "unchanged"},
+		{
+			name:      "added",
+			overrides: map[string]string{"X-Test": "1"},
+			expected:  map[string]string{"Accept": "text/html", "content-type": "text/plain", "X-Test": "1"},
+		},
+		{
+			name:      "replaced in any case",
+			overrides: map[string]string{"Content-Type": "application/json"},
+			expected:  map[string]string{"Accept": "text/html", "Content-Type": "application/json"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if value := request.mergeHeaders(test.overrides); !reflect.DeepEqual(value, test.expected) {
+				t.Errorf("headers %v, expected %v", value, test.expected)
+			}
+		})
+	}
+}
@@ -11,6 +11,15 @@ import (
 
 var ErrExecutionContextDestroyed = errors.New("execution context destroyed")
 
+// World is the name of an execution context of the frame, scripts of different worlds share DOM but not globals
+type World string
+
+const (
+	MainWorld World = ""
+	// UtilityWorld runs library helpers isolated from prototypes and globals overridden by the page
+	UtilityWorld World = "__control_utility_world"
+)
+
 type DOMException struct {
 	ExceptionDetails *runtime.ExceptionDetails
 }
@@ -23,20 +32,6 @@ func (e DOMException) Error() string {
 	return string(b)
 }
 
-type nodeType float64
-
-const (
-	nodeTypeElement               nodeType = 1  // An Element node like <p> or <div>
-	nodeTypeAttribute             nodeType = 2  // An Attribute of an Element
-	nodeTypeText                  nodeType = 3  // The actual Text inside an Element or Attr
-	nodeTypeCDataSection          nodeType = 4  // A CDATASection
-	nodeTypeProcessingInstruction nodeType = 7  // A ProcessingInstruction of an XML document
-	nodeTypeComment               nodeType = 8  // A Comment node
-	nodeTypeDocument              nodeType = 9  // A Document node
-	nodeTypeDocumentType          nodeType = 10 // A DocumentType node
-	nodeTypeFragment              nodeType = 11 // A DocumentFragment node
-)
-
 type RemoteObject interface {
 	GetRemoteObjectID() runtime.RemoteObjectId
 }
@@ -47,83 +42,6 @@ func (r remoteObjectValue) GetRemoteObjectID() runtime.RemoteObjectId {
 	return runtime.RemoteObjectId(r)
 }
 
-func getNodeType(deepSerializedValue any) nodeType {
-	return nodeType(deepSerializedValue.(map[string]any)["nodeType"].(float64))
-}
-
-func deepUnserialize(self string, value any) any {
-	switch self {
-	case "boolean", "string", "number":
-		return value
-	case "undefined", "null":
-		return nil
-	case "array":
-		if value == nil {
-			return value
-		}
-		arr := []any{}
-		for _, e := range value.([]any) {
-			pair := e.(map[string]any)
-			arr = append(arr, deepUnserialize(pair["type"].(string), pair["value"]))
-		}
-		return arr
-	case "object":
-		if value == nil {
-			return value
-		}
-		obj := map[string]any{}
-		for _, e := range value.([]any) {
-			var (
-				val  = e.([]any)
-				pair = val[1].(map[string]any)
-			)
-			obj[val[0].(string)] = deepUnserialize(pair["type"].(string), pair["value"])
-		}
-		return obj
-	default:
-		return value
-	}
-}
-
-// implemented
-// + undefined, null, string, number, boolean, promise, node, array, object, bigint, function, window
-// unimplemented
-// - regexp, date, symbol, map, set, weakmap, weakset, error, proxy, typedarray, arraybuffer
-func (f *Frame) unserialize(value *runtime.RemoteObject) (any, error) {
-	if value == nil {
-		return nil, errors.New("can't unserialize nil RemoteObject")
-	}
-	if value.DeepSerializedValue == nil {
-		return value.Value, nil
-	}
-
-	switch value.DeepSerializedValue.Type {
-
-	case "promise", "function", "weakmap":
-		return remoteObjectValue(value.ObjectId), nil
-
-	case "node":
-		switch getNodeType(value.DeepSerializedValue.Value) {
-		case nodeTypeElement, nodeTypeDocument:
-			return &Node{
-				object: remoteObjectValue(value.ObjectId),
-				frame:  f,
-			}, nil
-		default:
-			return nil, errors.New("unsupported type of node")
-		}
-
-	case "nodelist":
-		if value.Description == "NodeList(0)" {
-			return nil, nil
-		}
-		return f.requestNodeList(value.ObjectId)
-
-	default:
-		return deepUnserialize(value.DeepSerializedValue.Type, value.DeepSerializedValue.Value), nil
-	}
-}
-
 func (f *Frame) requestNodeList(objectId runtime.RemoteObjectId) (NodeList, error) {
 	descriptor, err := f.getProperties(remoteObjectValue(objectId), true, false, false, false)
 	if err != nil {
@@ -146,35 +64,29 @@ func (f *Frame) requestNodeList(objectId runtime.RemoteObjectId) (NodeList, erro
 	return nodeList, nil
 }
 
-func (f Frame) toCallArgument(args ...any) (arguments []*runtime.CallArgument) {
-	for _, arg := range args {
-		callArg := runtime.CallArgument{}
-		switch a := arg.(type) {
-		case RemoteObject:
-			callArg.ObjectId = a.GetRemoteObjectID()
-		default:
-			callArg.Value = a
-		}
-		arguments = append(arguments, &callArg)
-	}
-	return
+func (f Frame) evaluate(expression string, awaitPromise bool) (any, error) {
+	return f.evaluateIn(MainWorld, expression, awaitPromise)
 }
 
-func (f Frame) evaluate(expression string, awaitPromise bool) (any, error) {
-	var uid = f.executionContextID()
-	if uid == "" {
-		return nil, ErrExecutionContextDestroyed
+func (f Frame) evaluateIn(world World, expression string, awaitPromise bool) (any, error) {
+	context, err := f.executionContext(world)
+	if err != nil {
+		return nil, err
 	}
-	value, err := runtime.Evaluate(f, runtime.EvaluateArgs{
+	args := runtime.EvaluateArgs{
 		Expression:            expression,
 		IncludeCommandLineAPI: true,
-		UniqueContextId:       uid,
+		UniqueContextId:       context.uniqueID,
 		AwaitPromise:          awaitPromise,
 		Timeout:               runtime.TimeDelta(f.session.timeout.Milliseconds()),
 		SerializationOptions: &runtime.SerializationOptions{
 			Serialization: "deep",
 		},
-	})
+	}
+	if args.UniqueContextId == "" {
+		args.ContextId = context.id
+	}
+	value, err := runtime.Evaluate(f, args)
 	if err != nil {
 		return nil, err
 	}
@@ -199,12 +111,20 @@ func (f Frame) AwaitPromise(promise RemoteObject) (any, error) {
 	return f.unserialize(value.Result)
 }
 
+// CallFunctionOn calls the function with self as this, see callArguments for the supported arguments.
+// Go functions passed as arguments are unregistered when the call returns,
+// so they can't be kept by the page e.g. as event listeners, use Session.Expose for those
 func (f Frame) CallFunctionOn(self RemoteObject, function string, awaitPromise bool, args ...any) (any, error) {
+	declaration, arguments, release, err := f.callArguments(function, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 	value, err := runtime.CallFunctionOn(f, runtime.CallFunctionOnArgs{
-		FunctionDeclaration: function,
+		FunctionDeclaration: declaration,
 		ObjectId:            self.GetRemoteObjectID(),
 		AwaitPromise:        awaitPromise,
-		Arguments:           f.toCallArgument(args...),
+		Arguments:           arguments,
 		SerializationOptions: &runtime.SerializationOptions{
 			Serialization: "deep",
 		},
@@ -0,0 +1,268 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ecwid/control/protocol/dom"
+	"github.com/ecwid/control/protocol/emulation"
+	"github.com/ecwid/control/protocol/page"
+)
+
+const (
+	ScreenshotPNG  = "png"
+	ScreenshotJPEG = "jpeg"
+	ScreenshotWEBP = "webp"
+)
+
+// screenshotMarker is the attribute of styles and masks added for the screenshot, they are removed after capture
+const screenshotMarker = `data-control-screenshot`
+
+const (
+	hideCaretStyle         = `*,*::before,*::after{caret-color:transparent!important}`
+	disableAnimationsStyle = `*,*::before,*::after{animation:none!important;transition:none!important}`
+)
+
+type ScreenshotOptions struct {
+	// Format is png (default), jpeg or webp
+	Format string
+	// Quality of jpeg and webp in range 0..100
+	Quality int
+	// FullPage captures the whole scrollable page instead of the viewport, ignored by Node.Screenshot
+	FullPage bool
+	// HideCaret makes the text caret transparent
+	HideCaret bool
+	// DisableAnimations removes CSS animations and transitions
+	DisableAnimations bool
+	// Mask covers the nodes with solid boxes of MaskColor
+	Mask []*Node
+	// MaskColor is CSS color of the masks, #FF00FF by default
+	MaskColor string
+	// OmitBackground makes the default white background transparent, png and webp only
+	OmitBackground bool
+}
+
+// Screenshot captures the viewport or the full page and returns the image
+func (s *Session) Screenshot(options ScreenshotOptions) ([]byte, error) {
+	if !options.FullPage {
+		return s.screenshot(nil, options)
+	}
+	metrics, err := page.GetLayoutMetrics(s)
+	if err != nil {
+		return nil, err
+	}
+	width, height := math.Ceil(metrics.CssContentSize.Width), math.Ceil(metrics.CssContentSize.Height)
+	// the page is resized keeping the scale factor and mobile emulation set by Session.SetDeviceMetricsOverride,
+	// zero values keep the browser's own
+	var override emulation.SetDeviceMetricsOverrideArgs
+	previous := s.deviceMetrics.Load()
+	if previous != nil {
+		override = *previous
+	}
+	override.Width, override.Height = int(width), int(height)
+	if err = emulation.SetDeviceMetricsOverride(s, override); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := s.restoreDeviceMetrics(previous); err != nil && !s.IsDone() {
+			s.Log("can't restore device metrics override", err)
+		}
+	}()
+	return s.screenshot(&page.Viewport{Width: width, Height: height, Scale: 1}, options)
+}
+
+// restoreDeviceMetrics returns the override of Session.SetDeviceMetricsOverride after the page is resized
+func (s *Session) restoreDeviceMetrics(previous *emulation.SetDeviceMetricsOverrideArgs) error {
+	if previous == nil {
+		return emulation.ClearDeviceMetricsOverride(s)
+	}
+	return emulation.SetDeviceMetricsOverride(s, *previous)
+}
+
+func (s *Session) MustScreenshot(options ScreenshotOptions) []byte {
+	value, err := s.Screenshot(options)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// Screenshot captures the area of the node's bounding client rect
+func (e Node) Screenshot(options ScreenshotOptions) ([]byte, error) {
+	if err := e.scrollIntoView(); err != nil {
+		return nil, err
+	}
+	clip, err := e.pageRect()
+	if err != nil {
+		return nil, err
+	}
+	if clip.Width == 0 || clip.Height == 0 {
+		return nil, errors.New("node has zero size")
+	}
+	return e.frame.session.root().screenshot(clip, options)
+}
+
+func (e Node) MustScreenshot(options ScreenshotOptions) []byte {
+	value, err := e.Screenshot(options)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// root returns the page session, out-of-process iframes are rendered by it
+func (s *Session) root() *Session {
+	for s.parent != nil {
+		s = s.parent
+	}
+	return s
+}
+
+// GetPageRect returns the bounding client rect of the node in CSS pixels of the top document, the area of Node.Screenshot
+func (e Node) GetPageRect() Optional[dom.Rect] {
+	value, err := e.pageRect()
+	if err != nil {
+		return Optional[dom.Rect]{err: err}
+	}
+	return Optional[dom.Rect]{value: dom.Rect{X: value.X, Y: value.Y, Width: value.Width, Height: value.Height}}
+}
+
+func (e Node) MustGetPageRect() dom.Rect {
+	return e.GetPageRect().MustGetValue()
+}
+
+// pageRect returns the bounding client rect of the node in CSS pixels of the top document
+func (e Node) pageRect() (*page.Viewport, error) {
+	value, err := e.utilityEval(`function() {
+		const r = this.getBoundingClientRect()
+		return {x: r.left, y: r.top, width: r.width, height: r.height}
+	}`)
+	if err != nil {
+		return nil, err
+	}
+	rect, err := decodeAs[dom.Rect](value).Unwrap()
+	if err != nil {
+		return nil, err
+	}
+	for frame := e.frame; frame.parent != nil; frame = frame.parent {
+		owner, err := frame.owner()
+		if err != nil {
+			return nil, err
+		}
+		value, err = owner.utilityEval(`function() {
+			const r = this.getBoundingClientRect(), s = getComputedStyle(this)
+			return {x: r.left + this.clientLeft + parseFloat(s.paddingLeft), y: r.top + this.clientTop + parseFloat(s.paddingTop)}
+		}`)
+		if err != nil {
+			return nil, err
+		}
+		offset, err := decodeAs[Point](value).Unwrap()
+		if err != nil {
+			return nil, err
+		}
+		rect.X += offset.X
+		rect.Y += offset.Y
+	}
+	metrics, err := page.GetLayoutMetrics(e.frame.session.root())
+	if err != nil {
+		return nil, err
+	}
+	return &page.Viewport{
+		X:      rect.X + metrics.CssVisualViewport.PageX,
+		Y:      rect.Y + metrics.CssVisualViewport.PageY,
+		Width:  rect.Width,
+		Height: rect.Height,
+		Scale:  1,
+	}, nil
+}
+
+func (s *Session) screenshot(clip *page.Viewport, options ScreenshotOptions) ([]byte, error) {
+	if options.Format == "" {
+		options.Format = ScreenshotPNG
+	}
+	if options.Format == ScreenshotPNG && options.Quality != 0 {
+		return nil, fmt.Errorf("quality is not supported by %s", options.Format)
+	}
+	if options.OmitBackground {
+		err := emulation.SetDefaultBackgroundColorOverride(s, emulation.SetDefaultBackgroundColorOverrideArgs{Color: &dom.RGBA{}})
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := emulation.SetDefaultBackgroundColorOverride(s, emulation.SetDefaultBackgroundColorOverrideArgs{}); err != nil && !s.IsDone() {
+				s.Log("can't reset default background color", err)
+			}
+		}()
+	}
+	defer s.removeScreenshotDecorations()
+	if err := s.decorateScreenshot(options); err != nil {
+		return nil, err
+	}
+	val, err := page.CaptureScreenshot(s, page.CaptureScreenshotArgs{
+		Format:                options.Format,
+		Quality:               options.Quality,
+		Clip:                  clip,
+		FromSurface:           true,
+		CaptureBeyondViewport: clip != nil,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return val.Data, nil
+}
+
+// decorateScreenshot adds styles to every frame of the page and boxes over the masked nodes,
+// the boxes are fixed at viewport coordinates of the node, so they are not shifted by positioned document element or scroll
+func (s *Session) decorateScreenshot(options ScreenshotOptions) error {
+	var style string
+	if options.HideCaret {
+		style += hideCaretStyle
+	}
+	if options.DisableAnimations {
+		style += disableAnimationsStyle
+	}
+	if style != "" {
+		for _, frame := range s.Frames() {
+			_, err := frame.evaluateIn(UtilityWorld, fmt.Sprintf(`(() => {
+				const e = document.createElement('style')
+				e.setAttribute('%s', '')
+				e.textContent = %q
+				document.documentElement.append(e)
+			})()`, screenshotMarker, style), false)
+			if err != nil && err != ErrExecutionContextDestroyed {
+				return err
+			}
+		}
+	}
+	var color = options.MaskColor
+	if color == "" {
+		color = "#FF00FF"
+	}
+	for _, node := range options.Mask {
+		_, err := node.utilityEval(`function(marker, color) {
+			const r = this.getBoundingClientRect(), d = this.ownerDocument, m = d.createElement('div')
+			m.setAttribute(marker, '')
+			m.style.cssText = 'position:fixed;z-index:2147483647;pointer-events:none;margin:0;border:0'
+			m.style.left = r.left + 'px'
+			m.style.top = r.top + 'px'
+			m.style.width = r.width + 'px'
+			m.style.height = r.height + 'px'
+			m.style.background = color
+			d.documentElement.append(m)
+		}`, screenshotMarker, color)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Session) removeScreenshotDecorations() {
+	for _, frame := range s.Frames() {
+		_, err := frame.evaluateIn(UtilityWorld, `document.querySelectorAll('[`+screenshotMarker+`]').forEach(e => e.remove())`, false)
+		if err != nil && err != ErrExecutionContextDestroyed && !frame.session.IsDone() {
+			s.Log("can't remove screenshot decorations", err, "frameId", frame.id)
+		}
+	}
+}
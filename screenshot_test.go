@@ -0,0 +1,57 @@
+package control
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/ecwid/control/protocol/common"
+	"github.com/ecwid/control/protocol/emulation"
+	"github.com/ecwid/control/protocol/page"
+)
+
+func TestFullPageScreenshotRestoresDeviceMetrics(t *testing.T) {
+	var (
+		mutex     sync.Mutex
+		overrides []emulation.SetDeviceMetricsOverrideArgs
+	)
+	session, conn := newFakeSession(t, func(method string, params json.RawMessage) (any, error) {
+		switch method {
+		case "Page.getLayoutMetrics":
+			return page.GetLayoutMetricsVal{CssContentSize: &common.Rect{Width: 800, Height: 2000}}, nil
+		case "Page.captureScreenshot":
+			return page.CaptureScreenshotVal{Data: []byte("image")}, nil
+		case "Emulation.setDeviceMetricsOverride":
+			var args emulation.SetDeviceMetricsOverrideArgs
+			if err := json.Unmarshal(params, &args); err != nil {
+				return nil, err
+			}
+			mutex.Lock()
+			overrides = append(overrides, args)
+			mutex.Unlock()
+		}
+		return nil, nil
+	})
+	emulated := emulation.SetDeviceMetricsOverrideArgs{Width: 375, Height: 667, DeviceScaleFactor: 2, Mobile: true}
+	session.MustSetDeviceMetricsOverride(emulated)
+	session.MustScreenshot(ScreenshotOptions{FullPage: true})
+	expected := []emulation.SetDeviceMetricsOverrideArgs{
+		emulated,
+		{Width: 800, Height: 2000, DeviceScaleFactor: 2, Mobile: true},
+		emulated,
+	}
+	mutex.Lock()
+	if !reflect.DeepEqual(overrides, expected) {
+		t.Errorf("overrides %+v, expected %+v", overrides, expected)
+	}
+	mutex.Unlock()
+	if value := session.deviceMetrics.Load(); value == nil || !reflect.DeepEqual(*value, emulated) {
+		t.Errorf("recorded override %+v, expected %+v", value, emulated)
+	}
+	session.MustClearDeviceMetricsOverride()
+	session.MustScreenshot(ScreenshotOptions{FullPage: true})
+	if n := conn.calls("Emulation.clearDeviceMetricsOverride"); n != 2 {
+		t.Errorf("%d calls of clearDeviceMetricsOverride, expected 2", n)
+	}
+}
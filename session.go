@@ -6,12 +6,14 @@ import (
 	"errors"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ecwid/control/cdp"
 	"github.com/ecwid/control/protocol/browser"
 	"github.com/ecwid/control/protocol/common"
 	"github.com/ecwid/control/protocol/dom"
+	"github.com/ecwid/control/protocol/emulation"
 	"github.com/ecwid/control/protocol/network"
 	"github.com/ecwid/control/protocol/overlay"
 	"github.com/ecwid/control/protocol/page"
@@ -54,7 +56,21 @@ type Session struct {
 	transport        *cdp.Transport
 	targetID         target.TargetID
 	sessionID        string
-	frames           *sync.Map
+	cancel           func(error)
+	unsubscribe      func()
+	parent           *Session
+	children         *sync.Map
+	frames           *frameRegistry
+	routes           *routeTable
+	callbacks        *callbackRegistry
+	initScripts      *initScriptTable
+	console          *consoleHub
+	dialogs          *dialogHandlers
+	downloads        *downloadManager
+	fileChoosers     *fileChooserInterception
+	deviceMetrics    *atomic.Pointer[emulation.SetDeviceMetricsOverrideArgs]
+	har              *harRecorder
+	harMutex         *sync.Mutex
 	Frame            *Frame
 	highlightEnabled bool
 	mouse            Mouse
@@ -133,11 +149,38 @@ func (s *Session) Subscribe() (channel chan cdp.Message, cancel func()) {
 }
 
 func NewSession(transport *cdp.Transport, targetID target.TargetID) (*Session, error) {
+	session := newSession(transport.Context(), transport, targetID)
+	val, err := target.AttachToTarget(session, target.AttachToTargetArgs{
+		TargetId: targetID,
+		Flatten:  true,
+	})
+	if err != nil {
+		session.cancel(err)
+		return nil, err
+	}
+	session.sessionID = string(val.SessionId)
+	if err = session.init("page"); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func newSession(parent context.Context, transport *cdp.Transport, targetID target.TargetID) *Session {
 	var session = &Session{
-		transport: transport,
-		targetID:  targetID,
-		timeout:   60 * time.Second,
-		frames:    &sync.Map{},
+		transport:     transport,
+		targetID:      targetID,
+		timeout:       60 * time.Second,
+		frames:        newFrameRegistry(),
+		children:      &sync.Map{},
+		routes:        &routeTable{sessions: map[*Session]func(){}},
+		callbacks:     &callbackRegistry{funcs: map[string]bindingFunc{}},
+		initScripts:   &initScriptTable{scripts: map[InitScriptID]*initScript{}},
+		dialogs:       &dialogHandlers{fallback: DialogDismiss},
+		downloads:     &downloadManager{downloads: map[string]*Download{}},
+		fileChoosers:  &fileChooserInterception{},
+		deviceMetrics: &atomic.Pointer[emulation.SetDeviceMetricsOverrideArgs]{},
+		console:       &consoleHub{},
+		harMutex:      &sync.Mutex{},
 	}
 	session.mouse = NewMouse(session)
 	session.kb = NewKeyboard(session)
@@ -146,46 +189,121 @@ func NewSession(transport *cdp.Transport, targetID target.TargetID) (*Session, e
 		session: session,
 		id:      common.FrameId(session.targetID),
 	}
-	var cancel func(error)
-	session.context, cancel = context.WithCancelCause(transport.Context())
-	val, err := target.AttachToTarget(session, target.AttachToTargetArgs{
-		TargetId: targetID,
-		Flatten:  true,
-	})
-	if err != nil {
-		cancel(err)
-		return nil, err
-	}
-	session.sessionID = string(val.SessionId)
-	channel, unsubscribe := session.Subscribe()
+	session.routes.sessions[session] = nil
+	session.context, session.cancel = context.WithCancelCause(parent)
+	return session
+}
+
+func (s *Session) init(targetType string) error {
+	channel, unsubscribe := s.Subscribe()
+	s.unsubscribe = unsubscribe
 	go func() {
-		if err := session.handle(channel); err != nil {
+		if err := s.handle(channel); err != nil {
 			unsubscribe()
-			cancel(err)
+			s.cancel(err)
 		}
 	}()
-	if err = page.Enable(session); err != nil {
-		return nil, err
+	if targetType != "page" && targetType != "iframe" {
+		return nil // workers have no frames and DOM
 	}
-	if err = page.SetLifecycleEventsEnabled(session, page.SetLifecycleEventsEnabledArgs{Enabled: true}); err != nil {
-		return nil, err
+	if err := page.Enable(s); err != nil {
+		return err
 	}
-	if err = runtime.Enable(session); err != nil {
-		return nil, err
+	tree, err := page.GetFrameTree(s)
+	if err != nil {
+		return err
 	}
-	if err = dom.Enable(session, dom.EnableArgs{IncludeWhitespace: "none"}); err != nil {
-		return nil, err
+	s.frames.load(tree.FrameTree)
+	if err := page.SetLifecycleEventsEnabled(s, page.SetLifecycleEventsEnabledArgs{Enabled: true}); err != nil {
+		return err
 	}
-	if err = target.SetDiscoverTargets(session, target.SetDiscoverTargetsArgs{Discover: true}); err != nil {
-		return nil, err
+	if err := runtime.Enable(s); err != nil {
+		return err
 	}
-	if err = network.Enable(session, network.EnableArgs{MaxPostDataSize: MaxPostDataSize}); err != nil {
-		return nil, err
+	if err := dom.Enable(s, dom.EnableArgs{IncludeWhitespace: "none"}); err != nil {
+		return err
 	}
-	if err = runtime.AddBinding(session, runtime.AddBindingArgs{Name: hitCheckFunc}); err != nil {
-		return nil, err
+	if err := target.SetDiscoverTargets(s, target.SetDiscoverTargetsArgs{Discover: true}); err != nil {
+		return err
 	}
-	return session, nil
+	if err := network.Enable(s, network.EnableArgs{MaxPostDataSize: MaxPostDataSize}); err != nil {
+		return err
+	}
+	if err := runtime.AddBinding(s, runtime.AddBindingArgs{Name: hitCheckFunc}); err != nil {
+		return err
+	}
+	// the hit check runs in the utility world
+	if err := runtime.AddBinding(s, runtime.AddBindingArgs{Name: hitCheckFunc, ExecutionContextName: string(UtilityWorld)}); err != nil {
+		return err
+	}
+	// out-of-process iframes and workers are paused until attachChild resumes them
+	return target.SetAutoAttach(s, target.SetAutoAttachArgs{
+		AutoAttach:             true,
+		WaitForDebuggerOnStart: true,
+		Flatten:                true,
+	})
+}
+
+func (s *Session) attachChild(attached target.AttachedToTarget) {
+	child := newSession(s.context, s.transport, attached.TargetInfo.TargetId)
+	child.sessionID = string(attached.SessionId)
+	child.timeout = s.timeout
+	child.parent = s
+	// input of out-of-process iframes is dispatched by the page
+	child.mouse, child.kb, child.touch = s.mouse, s.kb, s.touch
+	s.children.Store(child.targetID, child)
+	// the target stays paused until it's resumed, even if its setup failed
+	defer func() {
+		if !attached.WaitingForDebugger {
+			return
+		}
+		if err := runtime.RunIfWaitingForDebugger(child); err != nil {
+			s.Log("can't resume child target", err, "targetId", child.targetID, "type", attached.TargetInfo.Type)
+		}
+	}()
+	err := child.init(attached.TargetInfo.Type)
+	if err == nil && (attached.TargetInfo.Type == "iframe" || attached.TargetInfo.Type == "page") {
+		err = errors.Join(s.initScriptsTo(child), s.exposeTo(child), s.routesTo(child))
+	}
+	if err != nil {
+		s.Log("can't attach to child target", err, "targetId", child.targetID, "type", attached.TargetInfo.Type)
+	}
+}
+
+func (s *Session) detachChild(sessionID string) {
+	s.children.Range(func(key, value any) bool {
+		child := value.(*Session)
+		if child.sessionID == sessionID {
+			s.children.Delete(key)
+			s.leaveRoutes(child)
+			child.unsubscribe()
+			child.cancel(ErrTargetDetached)
+			return false
+		}
+		return true
+	})
+}
+
+// Children returns sessions of auto-attached out-of-process iframes and workers
+func (s *Session) Children() []*Session {
+	var value []*Session
+	s.children.Range(func(_, child any) bool {
+		value = append(value, child.(*Session))
+		return true
+	})
+	return value
+}
+
+func (s *Session) child(targetID target.TargetID) (*Session, bool) {
+	value, ok := s.children.Load(targetID)
+	if !ok {
+		return nil, false
+	}
+	return value.(*Session), true
+}
+
+func (s *Session) Parent() *Session {
+	return s.parent
 }
 
 func (s *Session) EnableHighlight() error {
@@ -202,19 +320,59 @@ func (s *Session) handle(channel chan cdp.Message) error {
 
 		case "Runtime.executionContextCreated":
 			executionContextCreated := mustUnmarshal[runtime.ExecutionContextCreated](message)
-			aux := executionContextCreated.Context.AuxData.(map[string]any)
-			frameID := aux["frameId"].(string)
-			s.frames.Store(common.FrameId(frameID), executionContextCreated.Context.UniqueId)
+			aux, _ := executionContextCreated.Context.AuxData.(map[string]any)
+			if frameID, ok := aux["frameId"].(string); ok {
+				world := World(executionContextCreated.Context.Name)
+				if aux["isDefault"] == true {
+					world = MainWorld
+				}
+				s.frames.contextCreated(common.FrameId(frameID), world, executionContext{
+					id:       executionContextCreated.Context.Id,
+					uniqueID: executionContextCreated.Context.UniqueId,
+				})
+			}
+
+		case "Runtime.executionContextDestroyed":
+			executionContextDestroyed := mustUnmarshal[runtime.ExecutionContextDestroyed](message)
+			s.frames.contextDestroyed(executionContextDestroyed.ExecutionContextUniqueId)
+
+		case "Runtime.executionContextsCleared":
+			s.frames.contextsCleared()
+
+		case "Page.javascriptDialogOpening":
+			javascriptDialogOpening := mustUnmarshal[page.JavascriptDialogOpening](message)
+			go s.handleDialog(javascriptDialogOpening)
+
+		case "Target.attachedToTarget":
+			// browser-level attaches of other pages are delivered to every subscriber
+			if message.SessionID != s.sessionID {
+				continue
+			}
+			attachedToTarget := mustUnmarshal[target.AttachedToTarget](message)
+			go s.attachChild(attachedToTarget)
 
 		case "Page.frameDetached":
 			frameDetached := mustUnmarshal[page.FrameDetached](message)
-			s.frames.Delete(frameDetached.FrameId)
+			s.frames.detached(frameDetached.FrameId, frameDetached.Reason)
+
+		case "Page.frameAttached":
+			frameAttached := mustUnmarshal[page.FrameAttached](message)
+			s.frames.attached(frameAttached.FrameId, frameAttached.ParentFrameId)
+
+		case "Page.frameNavigated":
+			frameNavigated := mustUnmarshal[page.FrameNavigated](message)
+			s.frames.navigated(frameNavigated.Frame)
+
+		case "Page.navigatedWithinDocument":
+			navigatedWithinDocument := mustUnmarshal[page.NavigatedWithinDocument](message)
+			s.frames.navigatedWithinDocument(navigatedWithinDocument.FrameId, navigatedWithinDocument.Url)
 
 		case "Target.detachedFromTarget":
 			detachedFromTarget := mustUnmarshal[target.DetachedFromTarget](message)
 			if s.sessionID == string(detachedFromTarget.SessionId) {
 				return ErrTargetDetached
 			}
+			s.detachChild(string(detachedFromTarget.SessionId))
 
 		case "Target.targetDestroyed":
 			targetDestroyed := mustUnmarshal[target.TargetDestroyed](message)
@@ -267,11 +425,43 @@ func (s *Session) CaptureScreenshot(format string, quality int, clip *page.Viewp
 	return val.Data, nil
 }
 
+// SetDeviceMetricsOverride emulates the screen, the override is kept by full page Screenshot which resizes the page
+func (s *Session) SetDeviceMetricsOverride(args emulation.SetDeviceMetricsOverrideArgs) error {
+	if err := emulation.SetDeviceMetricsOverride(s, args); err != nil {
+		return err
+	}
+	s.deviceMetrics.Store(&args)
+	return nil
+}
+
+func (s *Session) MustSetDeviceMetricsOverride(args emulation.SetDeviceMetricsOverrideArgs) {
+	panicIfError(s.SetDeviceMetricsOverride(args))
+}
+
+func (s *Session) ClearDeviceMetricsOverride() error {
+	if err := emulation.ClearDeviceMetricsOverride(s); err != nil {
+		return err
+	}
+	s.deviceMetrics.Store(nil)
+	return nil
+}
+
+func (s *Session) MustClearDeviceMetricsOverride() {
+	panicIfError(s.ClearDeviceMetricsOverride())
+}
+
+// SetDownloadBehavior sets the behavior of the browser context of the session
 func (s *Session) SetDownloadBehavior(behavior string, downloadPath string, eventsEnabled bool) error {
-	return browser.SetDownloadBehavior(s, browser.SetDownloadBehaviorArgs{
-		Behavior:      behavior,
-		DownloadPath:  downloadPath,
-		EventsEnabled: eventsEnabled, // default false
+	info, err := target.GetTargetInfo(s, target.GetTargetInfoArgs{TargetId: s.targetID})
+	if err != nil {
+		return err
+	}
+	scope := downloadScope{transport: s.transport, browserContextID: info.TargetInfo.BrowserContextId}
+	return setDownloadBehavior(s, scope, browser.SetDownloadBehaviorArgs{
+		Behavior:         behavior,
+		BrowserContextId: scope.browserContextID,
+		DownloadPath:     downloadPath,
+		EventsEnabled:    eventsEnabled, // default false
 	})
 }
 
@@ -287,6 +477,30 @@ func (s *Session) GetTargetCreated() cdp.Future[target.TargetCreated] {
 	})
 }
 
+// WaitForPopup calls trigger and attaches to the page opened by this page
+func (s *Session) WaitForPopup(trigger func() error) (*Session, error) {
+	future := s.GetTargetCreated()
+	defer future.Cancel()
+	if err := trigger(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(s.context, s.timeout)
+	defer cancel()
+	created, err := future.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.AttachToTarget(created.TargetInfo.TargetId)
+}
+
+func (s *Session) MustWaitForPopup(trigger func() error) *Session {
+	value, err := s.WaitForPopup(trigger)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
 func (s *Session) AttachToTarget(id target.TargetID) (*Session, error) {
 	return NewSession(s.transport, id)
 }
@@ -0,0 +1,376 @@
+package control
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ecwid/control/protocol/dom"
+	"github.com/ecwid/control/protocol/runtime"
+)
+
+// JSError is an Error object returned by the script
+type JSError struct {
+	Name    string
+	Message string
+	Stack   string
+}
+
+func (e JSError) Error() string {
+	return e.Name + ": " + e.Message
+}
+
+// JSSymbol is a Symbol returned by the script, the value is its description
+type JSSymbol string
+
+// JSRegExp is a RegExp returned by the script which RE2 can't compile, e.g. with lookaround or backreferences
+type JSRegExp struct {
+	Pattern string
+	Flags   string
+}
+
+type MapEntry struct {
+	Key   any
+	Value any
+}
+
+// OrderedMap is a JS Map with entries in insertion order, keys are unserialized values of any type
+type OrderedMap []MapEntry
+
+func (m OrderedMap) Get(key any) (any, bool) {
+	for _, entry := range m {
+		if reflect.DeepEqual(entry.Key, key) {
+			return entry.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (m OrderedMap) Keys() []any {
+	var keys = make([]any, len(m))
+	for n, entry := range m {
+		keys[n] = entry.Key
+	}
+	return keys
+}
+
+// step of the path from the root object to the nested value: property of object or array, index of set item, map key or map value
+type step struct {
+	Kind string `json:"k"`
+	Key  any    `json:"v"`
+}
+
+// resolvePathFunc returns the nested value by path, map and set items are addressed by index
+const resolvePathFunc = `function(p){let v=this;for(const s of p)v=s.k==='m'?[...v.values()][s.v]:s.k==='k'?[...v.keys()][s.v]:s.k==='s'?[...v][s.v]:v[s.v];return v}`
+
+// unserializer converts deep serialized values (WebDriver BiDi format) to Go values.
+// Values without serialized content (errors, buffers, symbols, functions) are read via the handle
+// of the root object, nested ones are resolved by their path
+type unserializer struct {
+	frame *Frame
+	root  runtime.RemoteObjectId
+	refs  map[int]any
+}
+
+// implemented
+// + undefined, null, string, number, boolean, bigint, regexp, date, symbol, array, object, map, set,
+// + weakmap, weakset, error, proxy, promise, typedarray, arraybuffer, node, nodelist, htmlcollection, window,
+// + function, generator, cyclic references
+func (f *Frame) unserialize(value *runtime.RemoteObject) (any, error) {
+	if value == nil {
+		return nil, errors.New("can't unserialize nil RemoteObject")
+	}
+	if value.DeepSerializedValue == nil {
+		return value.Value, nil
+	}
+	u := &unserializer{
+		frame: f,
+		root:  value.ObjectId,
+		refs:  map[int]any{},
+	}
+	serialized := map[string]any{"type": value.DeepSerializedValue.Type}
+	if value.DeepSerializedValue.Value != nil {
+		serialized["value"] = value.DeepSerializedValue.Value
+	}
+	if ref := value.DeepSerializedValue.WeakLocalObjectReference; ref != 0 {
+		serialized["weakLocalObjectReference"] = float64(ref)
+	}
+	if value.DeepSerializedValue.Type == "nodelist" || value.DeepSerializedValue.Type == "htmlcollection" {
+		if strings.HasSuffix(value.Description, "(0)") {
+			return nil, nil
+		}
+		return f.requestNodeList(value.ObjectId)
+	}
+	return u.unserialize(serialized, nil)
+}
+
+func (u *unserializer) unserialize(serialized map[string]any, path []step) (value any, err error) {
+	var (
+		self        = serialized["type"].(string)
+		content     = serialized["value"]
+		ref, hasRef = serialized["weakLocalObjectReference"].(float64)
+	)
+	if hasRef {
+		if value, ok := u.refs[int(ref)]; ok {
+			return value, nil
+		}
+	}
+	// containers are registered before their items are unserialized to resolve cyclic references
+	register := func(value any) {
+		if hasRef {
+			u.refs[int(ref)] = value
+		}
+	}
+
+	switch self {
+	case "undefined", "null":
+		return nil, nil
+
+	case "boolean", "string":
+		value = content
+
+	case "number":
+		value, err = unserializeNumber(content)
+
+	case "bigint":
+		n, ok := new(big.Int).SetString(fmt.Sprint(content), 10)
+		if !ok {
+			return nil, fmt.Errorf("can't unserialize bigint `%v`", content)
+		}
+		value = n
+
+	case "regexp":
+		value, err = unserializeRegexp(content)
+
+	case "date":
+		value, err = unserializeDate(content)
+
+	case "array", "set":
+		items, _ := content.([]any)
+		arr := make([]any, len(items))
+		register(arr)
+		kind := "p"
+		if self == "set" {
+			kind = "s"
+		}
+		for n, item := range items {
+			if arr[n], err = u.unserialize(item.(map[string]any), appendStep(path, kind, n)); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+
+	case "object":
+		items, _ := content.([]any)
+		obj := make(map[string]any, len(items))
+		register(obj)
+		for _, item := range items {
+			pair := item.([]any)
+			key, ok := pair[0].(string)
+			if !ok {
+				continue // symbol keys
+			}
+			if obj[key], err = u.unserialize(pair[1].(map[string]any), appendStep(path, "p", key)); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+
+	case "map":
+		items, _ := content.([]any)
+		entries := make(OrderedMap, len(items))
+		register(entries)
+		for n, item := range items {
+			pair := item.([]any)
+			var key any = pair[0]
+			if serializedKey, ok := key.(map[string]any); ok {
+				if key, err = u.unserialize(serializedKey, appendStep(path, "k", n)); err != nil {
+					return nil, err
+				}
+			}
+			entries[n].Key = key
+			if entries[n].Value, err = u.unserialize(pair[1].(map[string]any), appendStep(path, "m", n)); err != nil {
+				return nil, err
+			}
+		}
+		return entries, nil
+
+	case "node":
+		value, err = u.node(content, path)
+
+	case "nodelist", "htmlcollection":
+		items, _ := content.([]any)
+		nodes := make(NodeList, 0, len(items))
+		for n, item := range items {
+			node, err := u.unserialize(item.(map[string]any), appendStep(path, "p", n))
+			if err != nil {
+				return nil, err
+			}
+			if node, ok := node.(*Node); ok {
+				nodes = append(nodes, node)
+			}
+		}
+		value = nodes
+
+	case "error":
+		value, err = u.callOnHandle(path, `function(){return {name:String(this.name),message:String(this.message),stack:String(this.stack)}}`, func(v any) (any, error) {
+			return decodeAs[JSError](v).Unwrap()
+		})
+
+	case "typedarray", "arraybuffer":
+		value, err = u.callOnHandle(path, `function(){const a=new Uint8Array(this instanceof ArrayBuffer?this:this.buffer,this.byteOffset||0,this.byteLength);let s='';for(let i=0;i<a.length;i+=8192)s+=String.fromCharCode.apply(null,a.subarray(i,i+8192));return btoa(s)}`, func(v any) (any, error) {
+			s, _ := v.(string)
+			return base64.StdEncoding.DecodeString(s)
+		})
+
+	case "symbol":
+		value, err = u.callOnHandle(path, `function(){return this.description}`, func(v any) (any, error) {
+			s, _ := v.(string)
+			return JSSymbol(s), nil
+		})
+
+	default:
+		// weakmap, weakset, proxy, promise, function, generator, window and others are passed by handle
+		var id runtime.RemoteObjectId
+		if id, err = u.handle(path); err == nil {
+			value = remoteObjectValue(id)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	register(value)
+	return value, nil
+}
+
+func appendStep(path []step, kind string, key any) []step {
+	return append(path[:len(path):len(path)], step{Kind: kind, Key: key})
+}
+
+// handle returns object id of the root or of the nested value by its path
+func (u *unserializer) handle(path []step) (runtime.RemoteObjectId, error) {
+	if len(path) == 0 {
+		return u.root, nil
+	}
+	value, err := runtime.CallFunctionOn(u.frame, runtime.CallFunctionOnArgs{
+		FunctionDeclaration: resolvePathFunc,
+		ObjectId:            u.root,
+		Arguments:           []*runtime.CallArgument{{Value: path}},
+	})
+	if err != nil {
+		return "", err
+	}
+	if err = toDOMException(value.ExceptionDetails); err != nil {
+		return "", err
+	}
+	return value.Result.ObjectId, nil
+}
+
+func (u *unserializer) callOnHandle(path []step, function string, convert func(any) (any, error)) (any, error) {
+	id, err := u.handle(path)
+	if err != nil {
+		return nil, err
+	}
+	value, err := runtime.CallFunctionOn(u.frame, runtime.CallFunctionOnArgs{
+		FunctionDeclaration: function,
+		ObjectId:            id,
+		ReturnByValue:       true,
+	})
+	if len(path) > 0 {
+		_ = runtime.ReleaseObject(u.frame, runtime.ReleaseObjectArgs{ObjectId: id})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = toDOMException(value.ExceptionDetails); err != nil {
+		return nil, err
+	}
+	return convert(value.Result.Value)
+}
+
+// node resolves the root node by its handle and the nested one by backendNodeId
+func (u *unserializer) node(content any, path []step) (*Node, error) {
+	if len(path) == 0 {
+		return &Node{object: remoteObjectValue(u.root), frame: u.frame}, nil
+	}
+	description, _ := content.(map[string]any)
+	backendNodeID, ok := description["backendNodeId"].(float64)
+	if !ok {
+		id, err := u.handle(path)
+		if err != nil {
+			return nil, err
+		}
+		return &Node{object: remoteObjectValue(id), frame: u.frame}, nil
+	}
+	args := dom.ResolveNodeArgs{BackendNodeId: dom.BackendNodeId(backendNodeID)}
+	if context, err := u.frame.executionContext(MainWorld); err == nil {
+		args.ExecutionContextId = context.id
+	}
+	value, err := dom.ResolveNode(u.frame, args)
+	if err != nil {
+		return nil, err
+	}
+	return &Node{object: remoteObjectValue(value.Object.ObjectId), frame: u.frame}, nil
+}
+
+func unserializeNumber(content any) (any, error) {
+	switch typed := content.(type) {
+	case float64:
+		return typed, nil
+	case string:
+		switch typed {
+		case "NaN":
+			return math.NaN(), nil
+		case "-0":
+			return math.Copysign(0, -1), nil
+		case "Infinity":
+			return math.Inf(1), nil
+		case "-Infinity":
+			return math.Inf(-1), nil
+		}
+	}
+	return nil, fmt.Errorf("can't unserialize number `%v`", content)
+}
+
+// unserializeRegexp converts JS flags to RE2 ones, flags without RE2 equivalent (g, y, u, d, v) are ignored.
+// The pattern RE2 doesn't support is returned as JSRegExp
+func unserializeRegexp(content any) (any, error) {
+	description, _ := content.(map[string]any)
+	pattern, _ := description["pattern"].(string)
+	flags, _ := description["flags"].(string)
+	var re2Flags string
+	for _, flag := range flags {
+		if strings.ContainsRune("ims", flag) {
+			re2Flags += string(flag)
+		}
+	}
+	var re2Pattern = pattern
+	if re2Flags != "" {
+		re2Pattern = "(?" + re2Flags + ")" + pattern
+	}
+	value, err := regexp.Compile(re2Pattern)
+	if err != nil {
+		return JSRegExp{Pattern: pattern, Flags: flags}, nil
+	}
+	return value, nil
+}
+
+// unserializeDate parses ISO string, the one of Date.prototype.toString is accepted as well
+func unserializeDate(content any) (time.Time, error) {
+	s, _ := content.(string)
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	// Mon Jan 02 2006 15:04:05 GMT-0700 (Coordinated Universal Time)
+	s, _, _ = strings.Cut(s, " (")
+	if t, err := time.Parse("Mon Jan 02 2006 15:04:05 GMT-0700", s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("can't unserialize date `%v`", content)
+}
@@ -0,0 +1,37 @@
+package control
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestUnserializeRegexp(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		flags    string
+		expected any
+	}{
+		{pattern: `a+b`, flags: "gi", expected: `(?i)a+b`},
+		{pattern: `\d+`, expected: `\d+`},
+		{pattern: `a(?=b)`, flags: "g", expected: JSRegExp{Pattern: `a(?=b)`, Flags: "g"}},
+		{pattern: `(a)\1`, expected: JSRegExp{Pattern: `(a)\1`}},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			value, err := unserializeRegexp(map[string]any{"pattern": test.pattern, "flags": test.flags})
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch typed := value.(type) {
+			case *regexp.Regexp:
+				if typed.String() != test.expected {
+					t.Errorf("regexp %s, expected %v", typed, test.expected)
+				}
+			default:
+				if typed != test.expected {
+					t.Errorf("value %#v, expected %#v", typed, test.expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package visual
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+const (
+	DefaultThreshold = 0.1
+	// ExactThreshold makes any color difference count
+	ExactThreshold = -1
+)
+
+var (
+	diffColor     = color.NRGBA{R: 255, A: 255}
+	aliasingColor = color.NRGBA{R: 255, G: 255, A: 255}
+	ignoredColor  = color.NRGBA{B: 255, A: 64}
+)
+
+type CompareOptions struct {
+	// Threshold is the allowed perceived color difference of a pixel in range 0..1, smaller is more sensitive.
+	// DefaultThreshold if 0, ExactThreshold or any negative value requires equal colors
+	Threshold float64
+	// IncludeAntiAliasing counts anti-aliased pixels as different, they are ignored by default
+	IncludeAntiAliasing bool
+	// IgnoreRects are skipped regions in pixels of the image
+	IgnoreRects []image.Rectangle
+}
+
+type CompareResult struct {
+	// DiffPixels is the number of different pixels, anti-aliased pixels are not counted unless IncludeAntiAliasing
+	DiffPixels  int
+	TotalPixels int
+	// Diff is the faded expected image with different pixels in red, anti-aliased in yellow and ignored regions in blue
+	Diff *image.NRGBA
+}
+
+// Compare compares images of the same size pixel by pixel in YIQ color space,
+// a different pixel is considered anti-aliased if it has similar siblings in both images
+func Compare(actual, expected image.Image, options CompareOptions) (CompareResult, error) {
+	if actual.Bounds().Size() != expected.Bounds().Size() {
+		return CompareResult{}, SizeMismatchError{Actual: actual.Bounds().Size(), Expected: expected.Bounds().Size()}
+	}
+	switch {
+	case options.Threshold == 0:
+		options.Threshold = DefaultThreshold
+	case options.Threshold < 0:
+		options.Threshold = 0
+	}
+	var (
+		a        = toNRGBA(actual)
+		e        = toNRGBA(expected)
+		w, h     = a.Rect.Dx(), a.Rect.Dy()
+		maxDelta = 35215 * options.Threshold * options.Threshold
+		result   = CompareResult{TotalPixels: w * h, Diff: image.NewNRGBA(image.Rect(0, 0, w, h))}
+	)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			switch {
+			case ignored(x, y, options.IgnoreRects):
+				result.Diff.SetNRGBA(x, y, blend(fade(e, x, y), ignoredColor))
+			case math.Abs(colorDelta(a, e, x, y, x, y, false)) <= maxDelta:
+				result.Diff.SetNRGBA(x, y, fade(e, x, y))
+			case !options.IncludeAntiAliasing && (antialiased(a, e, x, y) || antialiased(e, a, x, y)):
+				result.Diff.SetNRGBA(x, y, aliasingColor)
+			default:
+				result.Diff.SetNRGBA(x, y, diffColor)
+				result.DiffPixels++
+			}
+		}
+	}
+	return result, nil
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if value, ok := img.(*image.NRGBA); ok && value.Rect.Min == (image.Point{}) {
+		return value
+	}
+	value := image.NewNRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(value, value.Rect, img, img.Bounds().Min, draw.Src)
+	return value
+}
+
+func ignored(x, y int, rects []image.Rectangle) bool {
+	p := image.Point{X: x, Y: y}
+	for _, r := range rects {
+		if p.In(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// fade returns the light gray version of the pixel for the diff background
+func fade(img *image.NRGBA, x, y int) color.NRGBA {
+	r, g, b := blendWhite(img.NRGBAAt(x, y))
+	v := uint8(255 + (rgb2y(r, g, b)-255)*0.1)
+	return color.NRGBA{R: v, G: v, B: v, A: 255}
+}
+
+func blend(under, over color.NRGBA) color.NRGBA {
+	a := float64(over.A) / 255
+	mix := func(u, o uint8) uint8 { return uint8(float64(u)*(1-a) + float64(o)*a) }
+	return color.NRGBA{R: mix(under.R, over.R), G: mix(under.G, over.G), B: mix(under.B, over.B), A: 255}
+}
+
+// blendWhite composes semi-transparent pixel over white background
+func blendWhite(c color.NRGBA) (r, g, b float64) {
+	a := float64(c.A) / 255
+	return 255 + (float64(c.R)-255)*a, 255 + (float64(c.G)-255)*a, 255 + (float64(c.B)-255)*a
+}
+
+func rgb2y(r, g, b float64) float64 { return r*0.29889531 + g*0.58662247 + b*0.11448223 }
+func rgb2i(r, g, b float64) float64 { return r*0.59597799 - g*0.27417610 - b*0.32180189 }
+func rgb2q(r, g, b float64) float64 { return r*0.21147017 - g*0.52261711 + b*0.31114694 }
+
+// colorDelta returns squared YIQ distance of the pixels, only the brightness difference if yOnly,
+// the result is negative if the first pixel is brighter
+func colorDelta(img1, img2 *image.NRGBA, x1, y1, x2, y2 int, yOnly bool) float64 {
+	c1, c2 := img1.NRGBAAt(x1, y1), img2.NRGBAAt(x2, y2)
+	if c1 == c2 {
+		return 0
+	}
+	r1, g1, b1 := blendWhite(c1)
+	r2, g2, b2 := blendWhite(c2)
+	y := rgb2y(r1, g1, b1) - rgb2y(r2, g2, b2)
+	if yOnly {
+		return y
+	}
+	i := rgb2i(r1, g1, b1) - rgb2i(r2, g2, b2)
+	q := rgb2q(r1, g1, b1) - rgb2q(r2, g2, b2)
+	delta := 0.5053*y*y + 0.299*i*i + 0.1957*q*q
+	if rgb2y(r1, g1, b1) > rgb2y(r2, g2, b2) {
+		return -delta
+	}
+	return delta
+}
+
+// antialiased checks the pixel of img is on the edge between the darkest and the brightest siblings
+// and one of them has many equal siblings in both images
+func antialiased(img, other *image.NRGBA, x1, y1 int) bool {
+	var (
+		w, h           = img.Rect.Dx(), img.Rect.Dy()
+		zeroes         = 0
+		minDelta       = 0.0
+		maxDelta       = 0.0
+		minX, minY     int
+		maxX, maxY     int
+		x0, y0, x2, y2 = max(x1-1, 0), max(y1-1, 0), min(x1+1, w-1), min(y1+1, h-1)
+	)
+	if x1 == x0 || x1 == x2 || y1 == y0 || y1 == y2 {
+		zeroes = 1 // the pixel on the edge of the image
+	}
+	for x := x0; x <= x2; x++ {
+		for y := y0; y <= y2; y++ {
+			if x == x1 && y == y1 {
+				continue
+			}
+			delta := colorDelta(img, img, x1, y1, x, y, true)
+			switch {
+			case delta == 0:
+				zeroes++
+				if zeroes > 2 {
+					return false
+				}
+			case delta < minDelta:
+				minDelta, minX, minY = delta, x, y
+			case delta > maxDelta:
+				maxDelta, maxX, maxY = delta, x, y
+			}
+		}
+	}
+	if minDelta == 0 || maxDelta == 0 {
+		return false
+	}
+	return (manySiblings(img, minX, minY) && manySiblings(other, minX, minY)) ||
+		(manySiblings(img, maxX, maxY) && manySiblings(other, maxX, maxY))
+}
+
+// manySiblings checks more than two siblings have the same color as the pixel
+func manySiblings(img *image.NRGBA, x1, y1 int) bool {
+	var (
+		w, h           = img.Rect.Dx(), img.Rect.Dy()
+		zeroes         = 0
+		c              = img.NRGBAAt(x1, y1)
+		x0, y0, x2, y2 = max(x1-1, 0), max(y1-1, 0), min(x1+1, w-1), min(y1+1, h-1)
+	)
+	if x1 == x0 || x1 == x2 || y1 == y0 || y1 == y2 {
+		zeroes = 1
+	}
+	for x := x0; x <= x2; x++ {
+		for y := y0; y <= y2; y++ {
+			if x == x1 && y == y1 {
+				continue
+			}
+			if img.NRGBAAt(x, y) == c {
+				zeroes++
+				if zeroes > 2 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package visual
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func filled(w, h int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func withPixels(img *image.NRGBA, c color.Color, points ...image.Point) *image.NRGBA {
+	value := image.NewNRGBA(img.Rect)
+	copy(value.Pix, img.Pix)
+	for _, p := range points {
+		value.Set(p.X, p.Y, c)
+	}
+	return value
+}
+
+func TestCompare(t *testing.T) {
+	var (
+		white = color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+		black = color.NRGBA{A: 255}
+		gray  = color.NRGBA{R: 250, G: 250, B: 250, A: 255}
+		base  = filled(8, 8, white)
+		// edge is black on the left half and white on the right one
+		edge    = filled(8, 8, white)
+		gray128 = color.NRGBA{R: 128, G: 128, B: 128, A: 255}
+	)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 4; x++ {
+			edge.Set(x, y, black)
+		}
+	}
+	tests := []struct {
+		name       string
+		actual     image.Image
+		expected   image.Image
+		options    CompareOptions
+		diffPixels int
+		err        error
+	}{
+		{
+			name:     "equal",
+			actual:   base,
+			expected: filled(8, 8, white),
+		},
+		{
+			name:       "different pixels",
+			actual:     withPixels(base, black, image.Pt(1, 1), image.Pt(5, 6)),
+			expected:   base,
+			diffPixels: 2,
+		},
+		{
+			name:     "difference below threshold",
+			actual:   filled(8, 8, gray),
+			expected: base,
+		},
+		{
+			name:       "difference above strict threshold",
+			actual:     filled(8, 8, gray),
+			expected:   base,
+			options:    CompareOptions{Threshold: 0.01},
+			diffPixels: 64,
+		},
+		{
+			name:       "exact threshold",
+			actual:     filled(8, 8, color.NRGBA{R: 254, G: 255, B: 255, A: 255}),
+			expected:   base,
+			options:    CompareOptions{Threshold: ExactThreshold},
+			diffPixels: 64,
+		},
+		{
+			name:     "anti-aliased edge",
+			actual:   withPixels(edge, gray128, image.Pt(4, 3)),
+			expected: edge,
+		},
+		{
+			name:       "anti-aliased edge included",
+			actual:     withPixels(edge, gray128, image.Pt(4, 3)),
+			expected:   edge,
+			options:    CompareOptions{IncludeAntiAliasing: true},
+			diffPixels: 1,
+		},
+		{
+			name:       "ignored rect",
+			actual:     withPixels(base, black, image.Pt(1, 1), image.Pt(5, 6)),
+			expected:   base,
+			options:    CompareOptions{IgnoreRects: []image.Rectangle{image.Rect(0, 0, 3, 3)}},
+			diffPixels: 1,
+		},
+		{
+			name:     "size mismatch",
+			actual:   filled(8, 4, white),
+			expected: base,
+			err:      SizeMismatchError{Actual: image.Pt(8, 4), Expected: image.Pt(8, 8)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := Compare(test.actual, test.expected, test.options)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error %v, expected %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if result.DiffPixels != test.diffPixels {
+				t.Errorf("%d different pixels, expected %d", result.DiffPixels, test.diffPixels)
+			}
+			if result.TotalPixels != 64 {
+				t.Errorf("%d total pixels, expected 64", result.TotalPixels)
+			}
+			if result.Diff.Bounds().Size() != test.expected.Bounds().Size() {
+				t.Errorf("diff size %s, expected %s", result.Diff.Bounds().Size(), test.expected.Bounds().Size())
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package visual
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ecwid/control"
+	"github.com/ecwid/control/protocol/page"
+)
+
+// UpdateEnv is the environment variable which makes Match* functions write screenshots to the goldens instead of comparing,
+// e.g. `CONTROL_UPDATE_GOLDENS=1 go test ./...`
+const UpdateEnv = "CONTROL_UPDATE_GOLDENS"
+
+type Options struct {
+	CompareOptions
+	// Screenshot options, the format is always png
+	Screenshot control.ScreenshotOptions
+	// IgnoreNodes are masked with solid boxes in the screenshot and their areas are added to IgnoreRects
+	IgnoreNodes []*control.Node
+	// MaxDiffPixels is the number of different pixels the screenshot still matches with
+	MaxDiffPixels int
+}
+
+type SizeMismatchError struct {
+	Actual   image.Point
+	Expected image.Point
+}
+
+func (e SizeMismatchError) Error() string {
+	return fmt.Sprintf("image size %s differs from expected %s", e.Actual, e.Expected)
+}
+
+type MismatchError struct {
+	Golden      string
+	DiffPath    string
+	DiffPixels  int
+	TotalPixels int
+}
+
+func (e MismatchError) Error() string {
+	return fmt.Sprintf("screenshot differs from golden `%s` in %d of %d pixels, see %s", e.Golden, e.DiffPixels, e.TotalPixels, e.DiffPath)
+}
+
+// Updating reports whether goldens are updated instead of compared
+func Updating() bool {
+	value, _ := strconv.ParseBool(os.Getenv(UpdateEnv))
+	return value
+}
+
+// MatchScreenshot compares the screenshot of the session with the golden png
+func MatchScreenshot(session *control.Session, golden string, options Options) error {
+	actual, err := session.Screenshot(screenshotOptions(options))
+	if err != nil {
+		return err
+	}
+	var origin control.Point
+	if !options.Screenshot.FullPage {
+		metrics, err := page.GetLayoutMetrics(session)
+		if err != nil {
+			return err
+		}
+		origin = control.Point{X: metrics.CssVisualViewport.PageX, Y: metrics.CssVisualViewport.PageY}
+	}
+	if options.IgnoreRects, err = ignoreRects(session.Frame, origin, options); err != nil {
+		return err
+	}
+	return MatchImage(actual, golden, options)
+}
+
+// MatchNode compares the screenshot of the node with the golden png
+func MatchNode(node *control.Node, golden string, options Options) error {
+	actual, err := node.Screenshot(screenshotOptions(options))
+	if err != nil {
+		return err
+	}
+	rect, err := node.GetPageRect().Unwrap()
+	if err != nil {
+		return err
+	}
+	if options.IgnoreRects, err = ignoreRects(node.OwnerFrame(), control.Point{X: rect.X, Y: rect.Y}, options); err != nil {
+		return err
+	}
+	return MatchImage(actual, golden, options)
+}
+
+// ignoreRects adds areas of IgnoreNodes to IgnoreRects, origin is the top left corner of the screenshot in CSS pixels of the page
+func ignoreRects(frame *control.Frame, origin control.Point, options Options) ([]image.Rectangle, error) {
+	if len(options.IgnoreNodes) == 0 {
+		return options.IgnoreRects, nil
+	}
+	value, err := frame.Evaluate("devicePixelRatio", false).Unwrap()
+	if err != nil {
+		return nil, err
+	}
+	scale, ok := value.(float64)
+	if !ok || scale <= 0 {
+		return nil, fmt.Errorf("unexpected device pixel ratio %v", value)
+	}
+	var rects = append([]image.Rectangle(nil), options.IgnoreRects...)
+	for _, node := range options.IgnoreNodes {
+		r, err := node.GetPageRect().Unwrap()
+		if err != nil {
+			return nil, err
+		}
+		// the rect is rounded outwards to cover partially painted pixels
+		rects = append(rects, image.Rect(
+			int(math.Floor((r.X-origin.X)*scale)),
+			int(math.Floor((r.Y-origin.Y)*scale)),
+			int(math.Ceil((r.X+r.Width-origin.X)*scale)),
+			int(math.Ceil((r.Y+r.Height-origin.Y)*scale)),
+		))
+	}
+	return rects, nil
+}
+
+func screenshotOptions(options Options) control.ScreenshotOptions {
+	value := options.Screenshot
+	value.Format = control.ScreenshotPNG
+	value.Quality = 0
+	value.Mask = append(append([]*control.Node(nil), value.Mask...), options.IgnoreNodes...)
+	return value
+}
+
+// MatchImage compares the png with the golden one, the golden is written if UpdateEnv is set.
+// On mismatch the screenshot and the diff are written next to the golden as name.actual.png and name.diff.png
+func MatchImage(actual []byte, golden string, options Options) error {
+	var (
+		base       = strings.TrimSuffix(golden, filepath.Ext(golden))
+		actualPath = base + ".actual.png"
+		diffPath   = base + ".diff.png"
+	)
+	if Updating() {
+		if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(golden, actual, 0o644)
+	}
+	actualImage, err := png.Decode(bytes.NewReader(actual))
+	if err != nil {
+		return err
+	}
+	expected, err := os.ReadFile(golden)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("golden `%s` doesn't exist, run with %s=1 to create it: %w", golden, UpdateEnv, err)
+	}
+	if err != nil {
+		return err
+	}
+	expectedImage, err := png.Decode(bytes.NewReader(expected))
+	if err != nil {
+		return fmt.Errorf("golden `%s`: %w", golden, err)
+	}
+	result, err := Compare(actualImage, expectedImage, options.CompareOptions)
+	if err != nil {
+		return errors.Join(err, os.WriteFile(actualPath, actual, 0o644))
+	}
+	if result.DiffPixels <= options.MaxDiffPixels {
+		return errors.Join(removeIfExists(actualPath), removeIfExists(diffPath))
+	}
+	var diff bytes.Buffer
+	if err = png.Encode(&diff, result.Diff); err != nil {
+		return err
+	}
+	if err = errors.Join(os.WriteFile(actualPath, actual, 0o644), os.WriteFile(diffPath, diff.Bytes(), 0o644)); err != nil {
+		return err
+	}
+	return MismatchError{
+		Golden:      golden,
+		DiffPath:    diffPath,
+		DiffPixels:  result.DiffPixels,
+		TotalPixels: result.TotalPixels,
+	}
+}
+
+// removeIfExists removes outputs of the previous failed run
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}